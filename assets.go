@@ -0,0 +1,32 @@
+// Package assets embeds the templates, static files and migrations, so the binary runs from any directory
+package assets
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+//go:embed templates static migrations
+var embedded embed.FS
+
+// * Directories which can be opened with Open
+const (
+	Templates  = "templates"
+	Static     = "static"
+	Migrations = "migrations"
+)
+
+// Open: returns the named directory, read from dir on disk when dir is set and from the binary otherwise
+func Open(dir, name string) (fs.FS, error) {
+	if dir != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return os.DirFS(path), nil
+	}
+
+	return fs.Sub(embedded, name)
+}
@@ -0,0 +1,49 @@
+package assets
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, Templates), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, Templates, "only-on-disk.page.tmpl"), []byte(`disk`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		dirName  string
+		file     string
+		wantErr  bool
+		wantFile bool
+	}{
+		{name: "embedded templates", dirName: Templates, file: "base.layout.tmpl", wantFile: true},
+		{name: "embedded migrations", dirName: Migrations, file: "20231210091237_create_users_table.up.fizz", wantFile: true},
+		{name: "templates from disk", dir: dir, dirName: Templates, file: "only-on-disk.page.tmpl", wantFile: true},
+		{name: "disk does not fall back to the binary", dir: dir, dirName: Templates, file: "base.layout.tmpl", wantFile: false},
+		{name: "missing directory on disk", dir: dir, dirName: Static, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		fsys, err := Open(tt.dir, tt.dirName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error is %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		_, err = fs.Stat(fsys, tt.file)
+		if (err == nil) != tt.wantFile {
+			t.Errorf("%s: stat %s gave %v, want found %v", tt.name, tt.file, err, tt.wantFile)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/imrcht/bed-n-breakfast/internals/driver"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/migrate"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository/dbrepo"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// usage: prints the subcommands and flags
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, `Usage: %s [flags] [command]
+
+Commands:
+  serve                 start the web server (default)
+  migrate up            apply every pending migration
+  migrate down [n]      roll back the last n migrations (default 1)
+  migrate status        list migrations and whether they are applied
+  seed                  insert the rooms, restrictions and rate plans the app needs
+  create-admin          prompt for an email and password and create an admin user
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// setupCommand: prepares the logger, assets and database for a command that runs once
+func setupCommand() (*driver.DB, error) {
+	app.Logger = logging.New(os.Stderr, app.InProduction)
+
+	if err := openAssets(); err != nil {
+		return nil, err
+	}
+
+	// * Commands can't run in degraded mode, so an unreachable database is an error here
+	dbOptions.Logger = app.Logger
+	return driver.ConnectSql(context.Background(), *dsn, dbOptions)
+}
+
+// migrateCommand: runs migrate up|down|status
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := setupCommand()
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	migrator, err := migrate.New(db.SQL, app.Migrations)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Printf("applied   %s_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+
+		done, err := migrator.Down(ctx, steps)
+		for _, m := range done {
+			fmt.Printf("reverted  %s_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s  %s_%s\n", state, s.Version, s.Name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+}
+
+// seedCommand: runs the seed files shipped with the migrations
+func seedCommand() error {
+	db, err := setupCommand()
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	done, err := migrate.Seed(context.Background(), db.SQL, app.Migrations)
+	for _, file := range done {
+		fmt.Printf("seeded    %s\n", file)
+	}
+
+	return err
+}
+
+// createAdminCommand: prompts for the admin details and inserts the user with the admin access level
+func createAdminCommand() error {
+	db, err := setupCommand()
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	in := bufio.NewReader(os.Stdin)
+
+	email, err := prompt(in, "Email: ", false)
+	if err != nil {
+		return err
+	}
+	if !govalidator.IsEmail(email) {
+		return fmt.Errorf("invalid email %q", email)
+	}
+
+	firstName, err := prompt(in, "First name: ", false)
+	if err != nil {
+		return err
+	}
+
+	lastName, err := prompt(in, "Last name: ", false)
+	if err != nil {
+		return err
+	}
+
+	password, err := prompt(in, "Password: ", true)
+	if err != nil {
+		return err
+	}
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+
+	confirm, err := prompt(in, "Confirm password: ", true)
+	if err != nil {
+		return err
+	}
+	if password != confirm {
+		return errors.New("passwords do not match")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	repo := dbrepo.NewPostgressDBRepo(&app, db.SQL)
+
+	// * The audit entry names the admin being created, there is no logged in user
+	user, err := repo.InsertUser(context.Background(), models.User{
+		FirstName:   firstName,
+		LastName:    lastName,
+		Email:       email,
+		Password:    string(hashedPassword),
+		AccessLevel: models.AccessLevelAdmin,
+	}, models.Actor{Email: email, IP: "cli"})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s with id %d\n", user.Email, user.ID)
+	return nil
+}
+
+// prompt: reads one line from in, hiding the typed text when secret is set and stdin is a terminal
+func prompt(in *bufio.Reader, label string, secret bool) (string, error) {
+	fmt.Print(label)
+
+	// * A terminal is read line by line, so nothing typed is left buffered in in when the password is read straight from it
+	if fd := int(os.Stdin.Fd()); secret && term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(password)), nil
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
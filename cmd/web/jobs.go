@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// * jobs tracks the background goroutines so shutdown can wait for them to stop
+var jobs sync.WaitGroup
+
+// startJob: runs fn in the background, fn must return once ctx is cancelled
+func startJob(ctx context.Context, name string, fn func(ctx context.Context)) {
+	jobs.Add(1)
+
+	go func() {
+		defer jobs.Done()
+
+		app.Logger.Info("background job started", "job", name)
+		fn(ctx)
+		app.Logger.Info("background job stopped", "job", name)
+	}()
+}
@@ -1,18 +1,30 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	assets "github.com/imrcht/bed-n-breakfast"
 	"github.com/imrcht/bed-n-breakfast/internals/config"
 	"github.com/imrcht/bed-n-breakfast/internals/driver"
 	"github.com/imrcht/bed-n-breakfast/internals/handlers"
 	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/payments"
 	"github.com/imrcht/bed-n-breakfast/internals/render"
 )
 
@@ -22,27 +34,102 @@ const portNumber = ":8080"
 
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+
+// * How long shutdown waits for in-flight requests and queued mail
+var shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "time allowed to drain requests and mail on shutdown")
+
+var metricsAllow = flag.String("metrics-allow", "127.0.0.1/32,::1/128", "comma separated networks allowed to scrape /metrics")
+var assetsDir = flag.String("assets", "", "read templates, static files and migrations from this directory instead of the binary, e.g. . for the repo root")
+var dsn = flag.String("dsn", "host=localhost port=5432 dbname=bookings user=rachitgupta password=", "postgres connection string")
+
+// * Payment provider settings, the fake provider keeps payments in memory and needs none of the stripe ones
+var paymentProvider = flag.String("payments", "fake", "payment provider, fake or stripe")
+var stripeURL = flag.String("stripe-url", "https://api.stripe.com", "base url of the stripe api, e.g. http://localhost:12111 for stripe-mock")
+var stripeKey = flag.String("stripe-key", os.Getenv("STRIPE_SECRET_KEY"), "stripe secret key, defaults to $STRIPE_SECRET_KEY")
+var webhookSecret = flag.String("webhook-secret", os.Getenv("PAYMENTS_WEBHOOK_SECRET"), "secret payment webhooks are signed with, defaults to $PAYMENTS_WEBHOOK_SECRET")
+
+// * Connection pool and startup retry settings
+var dbOptions = driver.DefaultOptions()
+
+func init() {
+	flag.IntVar(&dbOptions.MaxOpenConns, "db-max-open", dbOptions.MaxOpenConns, "maximum open database connections")
+	flag.IntVar(&dbOptions.MaxIdleConns, "db-max-idle", dbOptions.MaxIdleConns, "maximum idle database connections")
+	flag.DurationVar(&dbOptions.ConnMaxLifetime, "db-max-lifetime", dbOptions.ConnMaxLifetime, "how long a database connection is reused")
+	flag.DurationVar(&dbOptions.ConnMaxIdleTime, "db-max-idle-time", dbOptions.ConnMaxIdleTime, "how long a database connection may stay idle")
+	flag.IntVar(&dbOptions.Attempts, "db-connect-attempts", dbOptions.Attempts, "database pings tried at startup before giving up")
+	flag.DurationVar(&dbOptions.Backoff, "db-connect-backoff", dbOptions.Backoff, "wait after the first failed ping, doubled on each retry")
+	flag.DurationVar(&app.DBQueryTimeout, "db-query-timeout", 3*time.Second, "longest a single database call may take")
+	flag.StringVar(&app.UploadsDir, "uploads", "uploads", "directory where uploaded room photos are stored")
+	flag.IntVar(&app.CleaningDays, "cleaning-days", 1, "days a room is blocked for cleaning after each checkout")
+	flag.DurationVar(&app.HoldDuration, "hold-duration", 15*time.Minute, "how long a chosen room is held while the guest fills in the reservation form, 0 turns holds off")
+	flag.IntVar(&app.DepositPercent, "deposit-percent", 100, "percent of the total held on the guest's card before a reservation is made, 1 to 100")
+}
 
 func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	// * Without a subcommand the web server is started
+	command := "serve"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+
+	var err error
+
+	switch command {
+	case "serve":
+		serve()
+		return
+	case "migrate":
+		err = migrateCommand(flag.Args()[1:])
+	case "seed":
+		err = seedCommand()
+	case "create-admin":
+		err = createAdminCommand()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
-	db, err := run()
 	if err != nil {
-		log.Fatal(err)
+		app.Logger.Error(command+" failed", "error", err)
+		os.Exit(1)
 	}
+}
 
-	defer db.SQL.Close()
-	defer close(app.MailChan)
+// serve: runs the web server until SIGINT/SIGTERM
+func serve() {
+	// * ctx is cancelled on SIGINT/SIGTERM and stops the startup retries and the background jobs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := run(ctx)
+	if err != nil {
+		app.Logger.Error("cannot start application", "error", err)
+		os.Exit(1)
+	}
 
 	// * Listen for mail channel
-	app.InfoLog.Println("Starting mail listener...")
-	listenForMailChan()
+	app.Logger.Info("starting mail listener")
+	mailDone := listenForMailChan()
+
+	// * Templates read from disk are reloaded when they change
+	if !app.UseCache {
+		startJob(ctx, "template watcher", func(ctx context.Context) {
+			render.WatchTemplates(ctx, time.Second)
+		})
+	}
+
+	// * Holds are ignored once expired, the rows are deleted in the background
+	startJob(ctx, "hold reaper", func(ctx context.Context) {
+		handlers.Repo.ReleaseExpiredHolds(ctx, time.Minute)
+	})
 
 	// http.HandleFunc("/", handlers.Repo.Home)
 	// http.HandleFunc("/about", handlers.Repo.About)
 
-	app.InfoLog.Printf("Server listening on port: %s", portNumber)
+	app.Logger.Info("server listening", "port", portNumber)
 
 	// We can use http.Server instance to run
 	srv := &http.Server{
@@ -50,31 +137,100 @@ func main() {
 		Handler: routes(&app),
 	}
 
-	err = srv.ListenAndServe()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	exitCode := 0
+
+	select {
+	case err = <-serverErr:
+		app.Logger.Error("server stopped", "error", err)
+		exitCode = 1
+		stop()
+	case <-ctx.Done():
+		app.Logger.Info("shutting down", "timeout", *shutdownTimeout)
+		// * Restore default signal handling so a second signal kills the process
+		stop()
+	}
+
+	if !shutdown(srv, mailDone, db) {
+		exitCode = 1
+	}
 
-	log.Fatal(err)
+	app.Logger.Info("shutdown complete")
+	os.Exit(exitCode)
 
 	// Or we can use directly ListenAndServer function to listen
 	// _ = http.ListenAndServe(portNumber, routes(&app))
 }
 
-func run() (*driver.DB, error) {
+// shutdown: stops accepting connections, waits for in-flight requests, queued mail and background jobs, then closes the database pool
+func shutdown(srv *http.Server, mailDone <-chan struct{}, db *driver.DB) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	clean := true
+
+	// * Shutdown returns nil once every in-flight request has finished, so nothing sends on the mail channel after it
+	// * When it times out requests may still be running, the channel is left open as closing it would make their sends panic
+	if err := srv.Shutdown(ctx); err != nil {
+		app.Logger.Error("cannot drain http requests", "error", err)
+		app.Logger.Error("mail queue not drained", "remaining", len(app.MailChan))
+		clean = false
+	} else {
+		// * Closing the channel lets the mail listener send what is queued and then exit
+		close(app.MailChan)
+		select {
+		case <-mailDone:
+		case <-ctx.Done():
+			app.Logger.Error("mail queue not drained", "remaining", len(app.MailChan))
+			clean = false
+		}
+	}
+
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		app.Logger.Error("background jobs did not stop in time")
+		clean = false
+	}
+
+	if err := db.SQL.Close(); err != nil {
+		app.Logger.Error("cannot close database", "error", err)
+		clean = false
+	}
+
+	return clean
+}
+
+func run(ctx context.Context) (*driver.DB, error) {
 	// * Adding custom var type to session
 	gob.Register(models.Reservation{})
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
 
-	// * Creating channel for sending mail data
-	mailChan := make(chan models.MailData)
+	// * Creating channel for sending mail data, buffered so handlers don't wait for the mail server
+	mailChan := make(chan models.MailData, 100)
 	app.MailChan = mailChan
 
-	infoLog = log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
-	errorLog = log.New(os.Stdout, "ERROR:\t", log.Ldate|log.Ltime|log.Lshortfile)
+	metrics.NewGaugeFunc("mail_queue_depth", "Mails waiting to be sent.", func() float64 {
+		return float64(len(app.MailChan))
+	})
 
 	// * Change this to true when in production
 	app.InProduction = false
 
+	// * Json logs in production, human readable text in development
+	app.Logger = logging.New(os.Stdout, app.InProduction)
+
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
 	session.Cookie.Persist = true
@@ -83,33 +239,142 @@ func run() (*driver.DB, error) {
 
 	app.Session = session
 
-	// * Connect to database
-	dsn := `host=localhost port=5432 dbname=bookings user=rachitgupta password=`
-	db, err := driver.ConnectSql(dsn)
-
+	allowedNets, err := parseNetworks(*metricsAllow)
 	if err != nil {
-		log.Fatal("Cannot connect to database! Dying...")
-		return db, err
+		return nil, err
 	}
+	app.MetricsAllowedNets = allowedNets
 
-	infoLog.Println("Connected to database!")
+	// * Connect to database, an unreachable database starts the app in degraded mode instead of failing
+	dbOptions.Logger = app.Logger
+	db, err := driver.ConnectSql(ctx, *dsn, dbOptions)
+	switch {
+	case errors.Is(err, driver.ErrUnavailable):
+		// * Pages that need the database fail and /readyz reports it until postgres answers
+		app.Logger.Error("starting in degraded mode", "error", err)
+		startJob(ctx, "database monitor", func(ctx context.Context) {
+			if db.WaitUntilAvailable(ctx, 5*time.Second) {
+				app.Logger.Info("database available, leaving degraded mode")
+			}
+		})
+	case err != nil:
+		return db, err
+	default:
+		app.Logger.Info("connected to database")
+	}
 
-	tc, err := render.CreateTemplateCache()
+	registerPoolMetrics(db)
 
+	err = openAssets()
 	if err != nil {
-		log.Fatal(err)
 		return db, err
 	}
 
-	app.TemplateCache = tc
-	app.UseCache = false
-	app.InfoLog = infoLog
-	app.ErrorLog = errorLog
+	gateway, err := paymentGateway()
+	if err != nil {
+		return db, err
+	}
 
-	repo := handlers.NewHandler(&app, db)
+	repo := handlers.NewHandler(&app, db, gateway)
 	handlers.NewRepo(repo)
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
+	// * In development a broken template is shown in the error overlay and fixed by the watcher, so only production refuses to start
+	err = render.LoadTemplates()
+	if err != nil {
+		if app.InProduction {
+			return db, err
+		}
+		app.Logger.Error("cannot build template cache", "error", err)
+	}
+
 	return db, nil
 }
+
+// paymentGateway: returns the payment provider chosen with -payments
+func paymentGateway() (payments.PaymentGateway, error) {
+	if app.DepositPercent < 1 || app.DepositPercent > 100 {
+		return nil, fmt.Errorf("-deposit-percent should be from 1 to 100, got %d", app.DepositPercent)
+	}
+
+	switch *paymentProvider {
+	case "fake":
+		app.Logger.Warn("payments use the fake provider, no money is taken")
+		return payments.NewFake(*webhookSecret), nil
+	case "stripe":
+		if *stripeKey == "" {
+			return nil, errors.New("-stripe-key or $STRIPE_SECRET_KEY is needed for stripe payments")
+		}
+		return payments.NewStripe(*stripeURL, *stripeKey, *webhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q, use fake or stripe", *paymentProvider)
+	}
+}
+
+// registerPoolMetrics: exposes the connection pool statistics on /metrics
+func registerPoolMetrics(db *driver.DB) {
+	metrics.NewGaugeFunc("db_open_connections", "Open database connections, in use and idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	metrics.NewGaugeFunc("db_in_use_connections", "Database connections currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	metrics.NewGaugeFunc("db_idle_connections", "Idle database connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	metrics.NewGaugeFunc("db_wait_count", "Total times a query waited for a free connection.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	metrics.NewGaugeFunc("db_wait_seconds", "Total time spent waiting for a free connection.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+}
+
+// openAssets: sets the templates, static files and migrations from the binary or from -assets
+func openAssets() error {
+	// * Embedded assets never change, assets read from disk are watched for edits
+	app.UseCache = *assetsDir == ""
+
+	for name, target := range map[string]*fs.FS{
+		assets.Templates:  &app.Templates,
+		assets.Static:     &app.Static,
+		assets.Migrations: &app.Migrations,
+	} {
+		var err error
+		*target, err = assets.Open(*assetsDir, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseNetworks: parses a comma separated list of CIDRs or single ips
+func parseNetworks(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
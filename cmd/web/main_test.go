@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/driver"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+func TestParseNetworks(t *testing.T) {
+	nets, err := parseNetworks(" 10.0.0.0/8, 127.0.0.1,::1 ,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"10.0.0.0/8", "127.0.0.1/32", "::1/128"}
+	if len(nets) != len(want) {
+		t.Fatalf("got %d networks, want %d", len(nets), len(want))
+	}
+	for i, n := range nets {
+		if n.String() != want[i] {
+			t.Errorf("network %d is %s, want %s", i, n, want[i])
+		}
+	}
+
+	if _, err := parseNetworks("10.0.0.0/33"); err == nil {
+		t.Error("expected an error for an invalid network")
+	}
+}
+
+// shutdownFixture: serves a request that blocks until release is closed and then queues a mail, as a booking does
+type shutdownFixture struct {
+	srv      *http.Server
+	url      string
+	started  chan struct{}
+	release  chan struct{}
+	mailDone chan struct{}
+	sent     chan models.MailData
+	db       *driver.DB
+}
+
+func newShutdownFixture(t *testing.T, timeout time.Duration) *shutdownFixture {
+	t.Helper()
+
+	app.Logger = logging.New(io.Discard, false)
+	app.MailChan = make(chan models.MailData, 10)
+	*shutdownTimeout = timeout
+
+	f := &shutdownFixture{
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+		mailDone: make(chan struct{}),
+		sent:     make(chan models.MailData, 10),
+	}
+
+	// * Stands in for the mail listener, it exits once the channel is closed and empty
+	go func() {
+		defer close(f.mailDone)
+		for msg := range app.MailChan {
+			f.sent <- msg
+		}
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.url = "http://" + ln.Addr().String()
+
+	f.srv = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(f.started)
+		<-f.release
+		app.MailChan <- models.MailData{To: "guest@example.com"}
+	})}
+	go f.srv.Serve(ln)
+
+	// * The pool is never connected, only closed
+	sqlDB, err := sql.Open("pgx", "host=127.0.0.1 port=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.db = &driver.DB{SQL: sqlDB}
+
+	return f
+}
+
+func TestShutdownDrainsRequestsBeforeClosingMail(t *testing.T) {
+	f := newShutdownFixture(t, 5*time.Second)
+
+	go http.Get(f.url)
+	<-f.started
+
+	clean := make(chan bool)
+	go func() {
+		clean <- shutdown(f.srv, f.mailDone, f.db)
+	}()
+
+	// * The request is still running, shutdown must wait for it before closing the mail channel
+	select {
+	case <-f.mailDone:
+		t.Fatal("mail channel closed while a request was in flight")
+	case <-clean:
+		t.Fatal("shutdown returned while a request was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(f.release)
+
+	if !<-clean {
+		t.Error("shutdown was not clean")
+	}
+	if len(f.sent) != 1 {
+		t.Errorf("%d mails sent, want the one queued by the request", len(f.sent))
+	}
+	if err := f.db.SQL.Ping(); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("database pool is not closed: %v", err)
+	}
+}
+
+func TestShutdownTimeoutLeavesMailOpen(t *testing.T) {
+	f := newShutdownFixture(t, 20*time.Millisecond)
+
+	go http.Get(f.url)
+	<-f.started
+
+	if shutdown(f.srv, f.mailDone, f.db) {
+		t.Error("shutdown was clean although a request outlived the timeout")
+	}
+
+	// * The late request still queues its mail, which would panic had the channel been closed
+	close(f.release)
+	select {
+	case <-f.sent:
+	case <-time.After(time.Second):
+		t.Error("mail of the late request was not queued")
+	}
+}
@@ -1,18 +1,96 @@
 package main
 
 import (
-	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
 	"github.com/justinas/nosurf"
 )
 
-// * WriteToConsole writes the request in every hit
-func WriteToConsole(next http.Handler) http.Handler {
+// * RequestLogger stores a logger tagged with the request id in the request context, so handlers and repository calls log with it
+func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("************** Hitting the url: ", r.URL, "**************")
-		next.ServeHTTP(w, r)
+		requestId := middleware.GetReqID(r.Context())
+		w.Header().Set("X-Request-Id", requestId)
+
+		logger := app.Logger.With("request_id", requestId)
+		next.ServeHTTP(w, r.WithContext(logging.WithLogger(r.Context(), logger)))
+	})
+}
+
+// * AccessLog logs the method, path, status, bytes written and duration of every request
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			logging.FromContext(r.Context(), app.Logger).Info("request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"duration", time.Since(start),
+			)
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// * Metrics records the count and latency of every request by its chi route pattern, so ids in urls don't create new series
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.HTTPRequests.Inc(r.Method, route, strconv.Itoa(status))
+		metrics.HTTPDuration.ObserveSince(start, r.Method, route)
+	})
+}
+
+// * MetricsAccess only lets clients from the configured networks scrape /metrics
+func MetricsAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		ip := net.ParseIP(host)
+		for _, allowed := range app.MetricsAllowedNets {
+			if ip != nil && allowed.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		helpers.ClientError(w, r, http.StatusForbidden)
 	})
 }
 
@@ -46,3 +124,15 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// * Admin only lets users with the admin access level through, it runs after Auth
+func Admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if helpers.UserAccessLevel(r) < models.AccessLevelAdmin {
+			helpers.ClientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
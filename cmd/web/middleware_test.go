@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+)
+
+func TestRequestLoggerAndAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	app.Logger = logging.New(&out, true)
+
+	handler := middleware.RequestID(RequestLogger(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context(), nil).Info("from handler")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/about", nil))
+
+	requestId := rr.Header().Get("X-Request-Id")
+	if requestId == "" {
+		t.Fatal("X-Request-Id header is not set")
+	}
+
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var line map[string]interface{}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("log line is not json: %v", err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want the handler's and the access log's", len(lines))
+	}
+	for _, line := range lines {
+		if line["request_id"] != requestId {
+			t.Errorf("%s: request_id is %v, want %s", line["msg"], line["request_id"], requestId)
+		}
+	}
+
+	access := lines[1]
+	if access["msg"] != "request" || access["method"] != "GET" || access["path"] != "/about" {
+		t.Errorf("access log is %v", access)
+	}
+	if access["status"] != float64(http.StatusTeapot) || access["bytes"] != float64(len("short and stout")) {
+		t.Errorf("access log status and bytes are %v and %v", access["status"], access["bytes"])
+	}
+}
+
+func TestAccessLogDefaultsToOK(t *testing.T) {
+	var out bytes.Buffer
+	app.Logger = logging.New(&out, true)
+
+	handler := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var access map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &access); err != nil {
+		t.Fatalf("log line is not json: %v", err)
+	}
+	if access["status"] != float64(http.StatusOK) {
+		t.Errorf("status is %v, want 200 when the handler writes nothing", access["status"])
+	}
+}
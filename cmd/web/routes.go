@@ -2,11 +2,13 @@ package main
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/imrcht/bed-n-breakfast/internals/config"
 	"github.com/imrcht/bed-n-breakfast/internals/handlers"
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
 )
 
 // * Routes returns mux router
@@ -20,19 +22,35 @@ func routes(app *config.AppConfig) http.Handler {
 	// * Using chi for routing
 	mux := chi.NewMux()
 
+	// * Every request gets an id which is carried by the request scoped logger
+	mux.Use(middleware.RequestID)
+	mux.Use(RequestLogger)
+	mux.Use(AccessLog)
+	mux.Use(Metrics)
+
 	// * Using recoverer middleware comes along with chi
 	mux.Use(middleware.Recoverer)
 	// mux.Use(NoSurf)
 	mux.Use(SessionLoad)
 
+	mux.With(MetricsAccess).Get("/metrics", metrics.Handler())
+	mux.Get("/healthz", handlers.Repo.Healthz)
+	mux.Get("/readyz", handlers.Repo.Readyz)
+
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
+	mux.Get("/rooms", handlers.Repo.Rooms)
+	mux.Get("/rooms/{slug}", handlers.Repo.Room)
+
+	// * The old hard coded room pages moved under /rooms
+	mux.Handle("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently))
+	mux.Handle("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently))
 
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
+	mux.Post("/search-availability-flexible", handlers.Repo.PostFlexibleAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Get("/availability-calendar", handlers.Repo.AvailabilityCalendar)
 	mux.Get("/choose-room/{id}", handlers.Repo.SelectRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 
@@ -42,6 +60,14 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
 
+	mux.Get("/find-booking", handlers.Repo.FindBooking)
+	mux.Post("/find-booking", handlers.Repo.PostFindBooking)
+	mux.Get("/my-booking", handlers.Repo.MyBooking)
+	mux.Post("/my-booking", handlers.Repo.PostMyBooking)
+	mux.Post("/my-booking/cancel", handlers.Repo.PostCancelBooking)
+
+	mux.Post("/payments/webhook", handlers.Repo.PaymentWebhook)
+
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
 	mux.Post("/user/register", handlers.Repo.PostSignUpJson)
@@ -50,12 +76,59 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Route("/admin", func(r chi.Router) {
 		// * Using middleware to check if user is authenticated
 		r.Use(Auth)
+		r.Use(Admin)
 		r.Get("/dashboard", handlers.Repo.AdminDashboard)
+		r.Get("/audit", handlers.Repo.AdminAudit)
+
+		r.Get("/rooms", handlers.Repo.AdminRooms)
+		r.Get("/rooms/{id}", handlers.Repo.AdminRoom)
+		r.Post("/rooms/{id}", handlers.Repo.PostAdminRoom)
+		r.Post("/rooms/{id}/delete", handlers.Repo.PostAdminDeleteRoom)
+		r.Post("/rooms/{id}/photos", handlers.Repo.PostAdminRoomPhotos)
+		r.Post("/rooms/{id}/photos/{photoId}/move", handlers.Repo.PostAdminMoveRoomPhoto)
+		r.Post("/rooms/{id}/photos/{photoId}/delete", handlers.Repo.PostAdminDeleteRoomPhoto)
+		r.Post("/rooms/{id}/stay-rules", handlers.Repo.PostAdminStayRule)
+		r.Post("/rooms/{id}/stay-rules/{ruleId}/delete", handlers.Repo.PostAdminDeleteStayRule)
+		r.Post("/rooms/{id}/rate-plans", handlers.Repo.PostAdminRatePlan)
+		r.Post("/rooms/{id}/rate-plans/{planId}/delete", handlers.Repo.PostAdminDeleteRatePlan)
+
+		r.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+		r.Post("/cancellation-policies", handlers.Repo.PostAdminCancellationPolicy)
+		r.Post("/cancellation-policies/{id}/delete", handlers.Repo.PostAdminDeleteCancellationPolicy)
+
+		r.Get("/reservations", handlers.Repo.AdminReservations)
+		r.Get("/reservations/{id}", handlers.Repo.AdminReservation)
+		r.Post("/reservations/{id}/cancel", handlers.Repo.PostAdminCancelReservation)
+		r.Post("/reservations/{id}/payments/{paymentId}/capture", handlers.Repo.PostAdminCapturePayment)
 	})
 
 	// Using static folder
-	fileServer := http.FileServer(http.Dir("./static"))
+	fileServer := http.FileServer(http.FS(app.Static))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
+	// * Uploaded photos are read from disk, without directory listings
+	uploadServer := http.FileServer(filesOnly{http.Dir(app.UploadsDir)})
+	mux.Handle("/uploads/*", http.StripPrefix("/uploads", uploadServer))
+
 	return mux
 }
+
+// * filesOnly serves files but answers not found for directories, so their contents can't be listed
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return file, nil
+}
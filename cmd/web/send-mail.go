@@ -3,19 +3,30 @@ package main
 import (
 	"time"
 
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
 
-func listenForMailChan() {
+// listenForMailChan: sends every mail that comes through the channel until it is closed, the returned channel is closed once the queue is drained
+func listenForMailChan() <-chan struct{} {
+	done := make(chan struct{})
+
+	// * Marked running before the goroutine starts, so readiness doesn't report it down while it is being scheduled
+	app.MailWorkerRunning.Store(true)
+
 	// * This function will execute in the background and listen for any value that comes through the channel all the time
 	go func() {
-		for {
-			// * Listening to mail channel
-			msg := <-app.MailChan
+		defer close(done)
+		defer app.MailWorkerRunning.Store(false)
+
+		// * Listening to mail channel, range stops once the channel is closed and empty
+		for msg := range app.MailChan {
 			sendMessage(msg)
 		}
 	}()
+
+	return done
 }
 
 func sendMessage(m models.MailData) {
@@ -31,7 +42,8 @@ func sendMessage(m models.MailData) {
 
 	client, err := server.Connect()
 	if err != nil {
-		app.ErrorLog.Println(err)
+		app.Logger.Error("cannot connect to mail server", "to", m.To, "error", err)
+		metrics.MailSendFailures.Inc()
 		return
 	}
 
@@ -41,9 +53,12 @@ func sendMessage(m models.MailData) {
 
 	err = email.Send(client)
 	if err != nil {
-		app.ErrorLog.Println(err)
+		app.Logger.Error("cannot send mail", "to", m.To, "subject", m.Subject, "error", err)
+		metrics.MailSendFailures.Inc()
 		return
 	}
 
-	app.InfoLog.Printf("Mail sent to %s", m.To)
+	metrics.MailSent.Inc()
+
+	app.Logger.Info("mail sent", "to", m.To, "subject", m.Subject)
 }
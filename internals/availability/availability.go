@@ -0,0 +1,174 @@
+package availability
+
+// * Works out which rooms are free from restrictions already read from the database, used to suggest other dates and split stays
+
+import (
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+// * Horizon is how many days before and after the requested dates are searched for another window
+const Horizon = 30
+
+// Finder: answers availability questions about Rooms, which should have their stay rules loaded, from the restrictions overlapping the searched period
+type Finder struct {
+	Rooms        []models.Room
+	Restrictions []models.RoomRestriction
+	// * Rooms other guests are holding while they book, each followed by its cleaning block like a reservation
+	Holds []models.RoomHold
+	// * A stay also needs its cleaning block after checkout to be free
+	CleaningDays int
+	// * Stays can't start before Today
+	Today time.Time
+}
+
+// Free: reports whether room can be booked from start to end
+func (f Finder) Free(room models.Room, start, end time.Time) bool {
+	if start.Before(f.Today) || room.CheckStay(start, end) != nil {
+		return false
+	}
+
+	blockedUntil := end.AddDate(0, 0, f.CleaningDays)
+	for _, rr := range f.Restrictions {
+		if rr.RoomID == room.ID && start.Before(rr.EndDate) && blockedUntil.After(rr.StartDate) {
+			return false
+		}
+	}
+
+	for _, h := range f.Holds {
+		if h.RoomID == room.ID && start.Before(h.EndDate.AddDate(0, 0, f.CleaningDays)) && blockedUntil.After(h.StartDate) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Options: returns a stay option for each room free from start to end
+func (f Finder) Options(start, end time.Time) []models.StayOption {
+	var options []models.StayOption
+	for _, room := range f.Rooms {
+		if f.Free(room, start, end) {
+			options = append(options, models.StayOption{Room: room, StartDate: start, EndDate: end})
+		}
+	}
+	return options
+}
+
+// Suggest: finds the nearest windows of the same length before and after start to end, and the split stay covering it with the fewest room changes
+func (f Finder) Suggest(start, end time.Time) models.Suggestions {
+	var suggestions models.Suggestions
+	nights := int(end.Sub(start).Hours() / 24)
+
+	for offset := 1; offset <= Horizon; offset++ {
+		s := start.AddDate(0, 0, -offset)
+		if s.Before(f.Today) {
+			break
+		}
+		if options := f.Options(s, s.AddDate(0, 0, nights)); len(options) > 0 {
+			suggestions.Earlier = options
+			break
+		}
+	}
+
+	for offset := 1; offset <= Horizon; offset++ {
+		s := start.AddDate(0, 0, offset)
+		if options := f.Options(s, s.AddDate(0, 0, nights)); len(options) > 0 {
+			suggestions.Later = options
+			break
+		}
+	}
+
+	suggestions.SplitStay = f.splitStay(start, end)
+
+	return suggestions
+}
+
+// splitStay: covers start to end with stays in different rooms, taking the room free for longest at each change, nil when there is a night no room is free
+func (f Finder) splitStay(start, end time.Time) []models.StayOption {
+	var stays []models.StayOption
+
+	for day := start; day.Before(end); {
+		var best models.StayOption
+
+		for _, room := range f.Rooms {
+			// * Longest stay from day in this room, tried from the end so stay rules on length are respected
+			for until := end; until.After(day); until = until.AddDate(0, 0, -1) {
+				if until.After(best.EndDate) && f.Free(room, day, until) {
+					best = models.StayOption{Room: room, StartDate: day, EndDate: until}
+					break
+				}
+			}
+		}
+
+		if best.EndDate.IsZero() {
+			return nil
+		}
+
+		stays = append(stays, best)
+		day = best.EndDate
+	}
+
+	// * A single stay means a room was free all along, it is not a split stay
+	if len(stays) < 2 {
+		return nil
+	}
+
+	return stays
+}
+
+// Calendar: returns the status of room on each day from start up to end, Restrictions and Holds should cover Horizon days either side
+// * A day is a possible arrival when some stay of up to Horizon nights starting on it is free, and a possible departure when some stay ending on it is
+func (f Finder) Calendar(room models.Room, start, end time.Time) []models.CalendarDay {
+	var days []models.CalendarDay
+
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		arrival := f.canArrive(room, day)
+		departure := f.canDepart(room, day)
+
+		status := models.DayBlocked
+		switch {
+		case arrival && departure:
+			status = models.DayAvailable
+		case arrival:
+			status = models.DayCheckInOnly
+		case departure:
+			status = models.DayCheckOutOnly
+		case f.restrictionOn(room, day) == models.RestrictionReservation:
+			status = models.DayBooked
+		}
+
+		days = append(days, models.CalendarDay{Date: day, Status: status})
+	}
+
+	return days
+}
+
+func (f Finder) canArrive(room models.Room, day time.Time) bool {
+	for nights := 1; nights <= Horizon; nights++ {
+		if f.Free(room, day, day.AddDate(0, 0, nights)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Finder) canDepart(room models.Room, day time.Time) bool {
+	for nights := 1; nights <= Horizon; nights++ {
+		if f.Free(room, day.AddDate(0, 0, -nights), day) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictionOn: returns the restriction id holding room on the night starting on day, 0 when the night is free
+func (f Finder) restrictionOn(room models.Room, day time.Time) int {
+	for _, rr := range f.Restrictions {
+		if rr.RoomID == room.ID && !day.Before(rr.StartDate) && day.Before(rr.EndDate) {
+			return rr.RestrictionID
+		}
+	}
+	return 0
+}
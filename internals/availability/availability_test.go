@@ -0,0 +1,159 @@
+package availability
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+var today = time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+
+// day: returns the date n days after today
+func day(n int) time.Time {
+	return today.AddDate(0, 0, n)
+}
+
+func reserved(roomId, from, to int) models.RoomRestriction {
+	return models.RoomRestriction{RoomID: roomId, StartDate: day(from), EndDate: day(to), RestrictionID: models.RestrictionReservation}
+}
+
+var (
+	room1 = models.Room{ID: 1, RoomName: "General's Quarters"}
+	room2 = models.Room{ID: 2, RoomName: "Major's Suite"}
+)
+
+func TestFinderFree(t *testing.T) {
+	tests := []struct {
+		name   string
+		finder Finder
+		from   int
+		to     int
+		want   bool
+	}{
+		{"nothing booked", Finder{}, 1, 3, true},
+		{"arrival before today", Finder{}, -1, 1, false},
+		{"departure not after arrival", Finder{}, 2, 2, false},
+		{"overlaps a reservation", Finder{Restrictions: []models.RoomRestriction{reserved(1, 2, 4)}}, 1, 3, false},
+		{"leaves the day the next guest arrives", Finder{Restrictions: []models.RoomRestriction{reserved(1, 2, 4)}}, 0, 2, true},
+		{"arrives the day the last guest leaves", Finder{Restrictions: []models.RoomRestriction{reserved(1, 2, 4)}}, 4, 6, true},
+		{"cleaning block after checkout collides", Finder{Restrictions: []models.RoomRestriction{reserved(1, 2, 4)}, CleaningDays: 1}, 0, 2, false},
+		{"another room is booked", Finder{Restrictions: []models.RoomRestriction{reserved(2, 0, 9)}}, 1, 3, true},
+		{"held by another guest", Finder{Holds: []models.RoomHold{{RoomID: 1, StartDate: day(2), EndDate: day(3)}}}, 1, 3, false},
+		{"cleaning after a hold collides", Finder{Holds: []models.RoomHold{{RoomID: 1, StartDate: day(1), EndDate: day(2)}}, CleaningDays: 1}, 2, 4, false},
+	}
+
+	for _, tt := range tests {
+		tt.finder.Today = today
+		if got := tt.finder.Free(room1, day(tt.from), day(tt.to)); got != tt.want {
+			t.Errorf("%s: Free(%d, %d) = %t, want %t", tt.name, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestFinderSuggest(t *testing.T) {
+	finder := Finder{
+		Rooms:        []models.Room{room1},
+		Restrictions: []models.RoomRestriction{reserved(1, 3, 5)},
+		Today:        today,
+	}
+
+	got := finder.Suggest(day(3), day(5))
+
+	want := models.Suggestions{
+		Earlier: []models.StayOption{{Room: room1, StartDate: day(1), EndDate: day(3)}},
+		Later:   []models.StayOption{{Room: room1, StartDate: day(5), EndDate: day(7)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Suggest = %+v, want %+v", got, want)
+	}
+}
+
+func TestFinderSuggestNothingEarlierThanToday(t *testing.T) {
+	finder := Finder{
+		Rooms:        []models.Room{room1},
+		Restrictions: []models.RoomRestriction{reserved(1, 0, 2)},
+		Today:        today,
+	}
+
+	if got := finder.Suggest(day(0), day(2)); got.Earlier != nil {
+		t.Errorf("Suggest earlier = %+v, want none before today", got.Earlier)
+	}
+}
+
+func TestFinderSplitStay(t *testing.T) {
+	tests := []struct {
+		name         string
+		restrictions []models.RoomRestriction
+		want         []models.StayOption
+	}{
+		{
+			name:         "changes room once",
+			restrictions: []models.RoomRestriction{reserved(1, 2, 4), reserved(2, 0, 2)},
+			want: []models.StayOption{
+				{Room: room1, StartDate: day(0), EndDate: day(2)},
+				{Room: room2, StartDate: day(2), EndDate: day(4)},
+			},
+		},
+		{
+			name:         "a night no room is free",
+			restrictions: []models.RoomRestriction{reserved(1, 2, 4), reserved(2, 1, 3)},
+			want:         nil,
+		},
+		{
+			name:         "one room is free all along",
+			restrictions: []models.RoomRestriction{reserved(2, 0, 2)},
+			want:         nil,
+		},
+	}
+
+	for _, tt := range tests {
+		finder := Finder{
+			Rooms:        []models.Room{room1, room2},
+			Restrictions: tt.restrictions,
+			Today:        today,
+		}
+
+		if got := finder.splitStay(day(0), day(4)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: splitStay = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFinderCalendar(t *testing.T) {
+	finder := Finder{
+		Restrictions: []models.RoomRestriction{
+			reserved(1, 2, 4),
+			{RoomID: 1, StartDate: day(7), EndDate: day(9), RestrictionID: models.RestrictionOwner},
+		},
+		Today: today,
+	}
+
+	want := []string{
+		models.DayCheckInOnly,  // * today, no stay can end on it
+		models.DayAvailable,    // * arrivals and departures both free
+		models.DayCheckOutOnly, // * the reservation arrives, a stay can only leave
+		models.DayBooked,       // * inside the reservation
+		models.DayCheckInOnly,  // * the reservation leaves, a stay can only arrive
+		models.DayAvailable,
+		models.DayAvailable,
+		models.DayCheckOutOnly, // * the owner's block arrives
+		models.DayBlocked,      // * inside the owner's block, not booked by a guest
+		models.DayCheckInOnly,
+	}
+
+	days := finder.Calendar(room1, day(0), day(len(want)))
+	if len(days) != len(want) {
+		t.Fatalf("Calendar returned %d days, want %d", len(days), len(want))
+	}
+
+	for i, d := range days {
+		if !d.Date.Equal(day(i)) {
+			t.Errorf("day %d: date is %s, want %s", i, d.Date.Format("2006-01-02"), day(i).Format("2006-01-02"))
+		}
+		if d.Status != want[i] {
+			t.Errorf("day %d: status is %s, want %s", i, d.Status, want[i])
+		}
+	}
+}
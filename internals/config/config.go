@@ -3,8 +3,11 @@ package config
 // * Config is imported by other parts of the application but it should not import anything else from the application itself otherwise it may create import cycle problem
 
 import (
-	"log"
-	"text/template"
+	"io/fs"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
@@ -12,11 +15,28 @@ import (
 
 // * AppConfig holds the application config
 type AppConfig struct {
-	UseCache      bool
-	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	// * When false templates are rebuilt as soon as a file under ./templates changes
+	UseCache     bool
+	Logger       *slog.Logger
+	InProduction bool
+	Session      *scs.SessionManager
+	MailChan     chan models.MailData
+	// * Set while the mail listener goroutine is running
+	MailWorkerRunning atomic.Bool
+	// * Templates, static files and migrations, embedded in the binary unless overridden with -assets
+	Templates  fs.FS
+	Static     fs.FS
+	Migrations fs.FS
+	// * Directory for uploaded room photos, served at /uploads
+	UploadsDir string
+	// * Networks allowed to scrape /metrics
+	MetricsAllowedNets []*net.IPNet
+	// * Longest a single repository call may take, on top of the request's own cancellation
+	DBQueryTimeout time.Duration
+	// * Days a room is blocked for cleaning after each checkout, 0 turns the block off
+	CleaningDays int
+	// * How long a room chosen by a guest is held for them while they fill in the reservation form, 0 turns holds off
+	HoldDuration time.Duration
+	// * Percent of the total authorized on the guest's card before a reservation is confirmed, 100 takes the whole stay
+	DepositPercent int
 }
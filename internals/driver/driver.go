@@ -1,7 +1,12 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
@@ -15,42 +20,125 @@ type DB struct {
 
 // * One of the popular ORM for Go is upperDb/upper.io
 
-func ConnectSql(dsn string) (*DB, error) {
-	d, err := NewDbConnection(dsn)
+// Options: tunes the connection pool and how long startup waits for the database
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// * Attempts is how many times the first ping is tried, Backoff is the wait after the first failure and doubles up to MaxBackoff
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Logger     *slog.Logger
+}
 
-	if err != nil {
-		panic(err)
+// DefaultOptions: returns the pool settings used when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		Attempts:        5,
+		Backoff:         time.Second,
+		MaxBackoff:      30 * time.Second,
 	}
+}
+
+// ErrUnavailable: is returned with a usable *DB when the database could not be reached, database/sql connects again on the next query
+var ErrUnavailable = errors.New("database unavailable")
 
-	err = testDBPing(d)
+// ConnectSql: opens the pool and pings it with retries, on ErrUnavailable the returned DB can still be used once postgres is up
+func ConnectSql(ctx context.Context, dsn string, opts Options) (*DB, error) {
+	d, err := NewDbConnection(dsn, opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	db := &DB{SQL: d}
 
+	err = db.waitForPing(ctx, opts)
+	if err != nil {
+		return db, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
 	return db, nil
 }
 
-func testDBPing(db *sql.DB) error {
-	err := db.Ping()
+// NewDbConnection: opens the pool without connecting, it only fails on an invalid dsn
+func NewDbConnection(dsn string, opts Options) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	return db, nil
 }
 
-func NewDbConnection(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("pgx", dsn)
+// waitForPing: pings until it succeeds, the attempts run out or ctx is cancelled
+func (db *DB) waitForPing(ctx context.Context, opts Options) error {
+	attempts := opts.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := opts.Backoff
 
-	if err != nil {
-		return nil, err
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = db.ping(ctx)
+		if err == nil || attempt >= attempts {
+			return err
+		}
+
+		if opts.Logger != nil {
+			opts.Logger.Warn("cannot reach database, retrying", "attempt", attempt, "of", attempts, "wait", backoff, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if opts.MaxBackoff > 0 && backoff > opts.MaxBackoff {
+			backoff = opts.MaxBackoff
+		}
 	}
+}
 
-	err = db.Ping()
-	if err != nil {
-		return nil, err
+func (db *DB) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return db.SQL.PingContext(ctx)
+}
+
+// WaitUntilAvailable: pings every interval until the database answers or ctx is done, for a start in degraded mode
+func (db *DB) WaitUntilAvailable(ctx context.Context, interval time.Duration) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if db.ping(ctx) == nil {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
 	}
+}
 
-	return db, nil
+// Stats: returns the pool statistics
+func (db *DB) Stats() sql.DBStats {
+	return db.SQL.Stats()
 }
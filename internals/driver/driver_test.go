@@ -0,0 +1,95 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// * Nothing listens on port 1, so every ping is refused straight away
+const unreachableDSN = "host=127.0.0.1 port=1 user=bookings dbname=bookings sslmode=disable connect_timeout=1"
+
+func TestConnectSqlRetriesWithBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		backoff    time.Duration
+		maxBackoff time.Duration
+		wantWaits  []string
+	}{
+		{name: "single attempt", attempts: 1, backoff: time.Millisecond},
+		{name: "zero attempts still pings once", attempts: 0, backoff: time.Millisecond},
+		{name: "backoff doubles", attempts: 4, backoff: time.Millisecond, wantWaits: []string{"1ms", "2ms", "4ms"}},
+		{name: "backoff is capped", attempts: 4, backoff: time.Millisecond, maxBackoff: 2 * time.Millisecond, wantWaits: []string{"1ms", "2ms", "2ms"}},
+	}
+
+	wait := regexp.MustCompile(`wait=(\S+)`)
+
+	for _, tt := range tests {
+		var logs bytes.Buffer
+		opts := DefaultOptions()
+		opts.Attempts = tt.attempts
+		opts.Backoff = tt.backoff
+		opts.MaxBackoff = tt.maxBackoff
+		opts.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+		db, err := ConnectSql(context.Background(), unreachableDSN, opts)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%s: error is %v, want ErrUnavailable", tt.name, err)
+		}
+		if db == nil {
+			t.Errorf("%s: no DB returned with ErrUnavailable, the app cannot start degraded", tt.name)
+			continue
+		}
+		db.SQL.Close()
+
+		var waits []string
+		for _, m := range wait.FindAllStringSubmatch(logs.String(), -1) {
+			waits = append(waits, m[1])
+		}
+		if strings.Join(waits, ",") != strings.Join(tt.wantWaits, ",") {
+			t.Errorf("%s: waited %v, want %v", tt.name, waits, tt.wantWaits)
+		}
+	}
+}
+
+func TestConnectSqlStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := DefaultOptions()
+	opts.Attempts = 5
+	opts.Backoff = time.Hour
+
+	start := time.Now()
+	db, err := ConnectSql(ctx, unreachableDSN, opts)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("error is %v, want ErrUnavailable", err)
+	}
+	if db != nil {
+		db.SQL.Close()
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("cancelled context did not stop the retries")
+	}
+}
+
+func TestWaitUntilAvailableGivesUp(t *testing.T) {
+	db, err := ConnectSql(context.Background(), unreachableDSN, Options{Attempts: 1})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("error is %v, want ErrUnavailable", err)
+	}
+	defer db.SQL.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if db.WaitUntilAvailable(ctx, 5*time.Millisecond) {
+		t.Error("unreachable database reported as available")
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
 )
 
+var (
+	slugPattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	moneyPattern = regexp.MustCompile(`^\d{1,7}(\.\d{1,2})?$`)
+)
+
 // Form: creates a custom form struct, embeds a url.Values object
 type Form struct {
 	url.Values
@@ -109,3 +116,51 @@ func (f *Form) IsValidPhone(field string, r *http.Request) bool {
 	}
 	return true
 }
+
+// IsSlug: checks that the field is lower case letters and digits separated by single dashes
+func (f *Form) IsSlug(field string) bool {
+	x := f.Get(field)
+
+	if !slugPattern.MatchString(x) {
+		f.Errors.Add(field, "Use lower case letters, digits and dashes only")
+		return false
+	}
+
+	return true
+}
+
+// IsIntBetween: checks that the field is a whole number from min to max
+func (f *Form) IsIntBetween(field string, min, max int) bool {
+	x, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+
+	if err != nil || x < min || x > max {
+		f.Errors.Add(field, fmt.Sprintf("This should be a number from %d to %d", min, max))
+		return false
+	}
+
+	return true
+}
+
+// IsMoney: checks that the field is an amount of dollars with at most two decimals, e.g. 95 or 95.50
+func (f *Form) IsMoney(field string) bool {
+	if _, ok := Cents(f.Get(field)); !ok {
+		f.Errors.Add(field, "This should be an amount such as 95 or 95.50")
+		return false
+	}
+
+	return true
+}
+
+// Cents: parses an amount of dollars such as "95.5" into cents, 9550
+func Cents(amount string) (int, bool) {
+	amount = strings.TrimSpace(amount)
+	if !moneyPattern.MatchString(amount) {
+		return 0, false
+	}
+
+	dollars, fraction, _ := strings.Cut(amount, ".")
+	d, _ := strconv.Atoi(dollars)
+	c, _ := strconv.Atoi((fraction + "00")[:2])
+
+	return d*100 + c, true
+}
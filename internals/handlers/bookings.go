@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imrcht/bed-n-breakfast/internals/availability"
+	"github.com/imrcht/bed-n-breakfast/internals/forms"
+	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/render"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// confirmationCode: normalizes a code typed by a guest, e.g. " bnb 7k3q9x" or "7K3Q9X" to BNB-7K3Q9X, false when it can't be a confirmation code
+func confirmationCode(input string) (string, bool) {
+	code := strings.ToUpper(strings.Join(strings.Fields(input), ""))
+	code = strings.ReplaceAll(code, "-", "")
+
+	// * The prefix is optional, it is only removed from a code long enough to have it
+	prefix := strings.TrimSuffix(models.ConfirmationCodePrefix, "-")
+	if len(code) == len(prefix)+models.ConfirmationCodeLength {
+		code = strings.TrimPrefix(code, prefix)
+	}
+
+	if len(code) != models.ConfirmationCodeLength {
+		return "", false
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(models.ConfirmationCodeAlphabet, c) {
+			return "", false
+		}
+	}
+
+	return models.ConfirmationCodePrefix + code, true
+}
+
+// FindBooking: renders the page where guests look up their booking with its confirmation code and email
+func (m *Repository) FindBooking(w http.ResponseWriter, r *http.Request) {
+	if err := render.Template(w, r, "find-booking.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// PostFindBooking: looks up a booking by confirmation code and email, remembers it in the session and redirects to my-booking page
+func (m *Repository) PostFindBooking(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "email")
+	form.IsValidEmail("email", r)
+
+	code, ok := confirmationCode(form.Get("code"))
+	if form.Get("code") != "" && !ok {
+		form.Errors.Add("code", "This is not a valid confirmation code")
+	}
+
+	var reservation models.Reservation
+	if form.Valid() {
+		var err error
+		reservation, err = m.DB.GetReservationByCode(r.Context(), code, strings.TrimSpace(form.Get("email")))
+		// * The same message whether the code or the email is wrong, so neither can be guessed on its own
+		if errors.Is(err, sql.ErrNoRows) {
+			form.Errors.Add("code", "No booking matches this confirmation code and email")
+		} else if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		if err := render.Template(w, r, "find-booking.page.tmpl", &models.TemplateData{
+			Form: form,
+			StringMap: map[string]string{
+				"code":  form.Get("code"),
+				"email": form.Get("email"),
+			},
+		}); err != nil {
+			helpers.ServerError(w, r, err)
+		}
+		return
+	}
+
+	// * Renew the session token, the session can now see the booking
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "booking_id", reservation.ID)
+
+	http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+}
+
+// bookingInSession: returns the booking found with find-booking page, false after redirecting there when there is none
+func (m *Repository) bookingInSession(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id := m.App.Session.GetInt(r.Context(), "booking_id")
+	if id == 0 {
+		m.App.Session.Put(r.Context(), "warning", "Enter your confirmation code and email to see your booking")
+		http.Redirect(w, r, "/find-booking", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	reservation, err := m.DB.GetReservationById(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return reservation, false
+	}
+
+	return reservation, true
+}
+
+// changeProblem: returns why the guest can't change the booking online, empty when they can
+func changeProblem(res models.Reservation) string {
+	if res.Cancelled() {
+		return "This booking has been cancelled"
+	}
+	if res.StartDate.Before(today()) {
+		return "This stay has already started, please contact us to change it"
+	}
+	return ""
+}
+
+// renderBooking: renders my-booking page with the rooms the guest can move to, and change waiting to be confirmed when it has an ID
+func (m *Repository) renderBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, change models.Reservation) {
+	view := models.BookingView{
+		Reservation: res,
+		CanChange:   changeProblem(res) == "",
+		Change:      change,
+		Fee:         res.CancellationFeeOn(today()),
+		DepositDue:  m.depositDue(res, change),
+	}
+
+	if view.CanChange {
+		rooms, err := m.DB.AllRooms(r.Context(), true)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		for _, room := range rooms {
+			if room.Fits(res.Adults, res.Children) {
+				view.Rooms = append(view.Rooms, room)
+			}
+		}
+	}
+
+	if err := render.Template(w, r, "booking.page.tmpl", &models.TemplateData{View: view}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// MyBooking: renders the booking found with find-booking page
+func (m *Repository) MyBooking(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.bookingInSession(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderBooking(w, r, reservation, models.Reservation{})
+}
+
+// bookingChange: returns res moved to the dates and room of the form and repriced at today's rates, or why it can't be moved there
+func (m *Repository) bookingChange(r *http.Request, res models.Reservation) (models.Reservation, string, error) {
+	change := res
+
+	startDate, endDate, err := stayDates(r.Form.Get("start"), r.Form.Get("end"))
+	if err != nil {
+		return change, stayMessage(err), nil
+	}
+
+	roomId, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil {
+		return change, "Choose a room", nil
+	}
+
+	room, err := m.DB.GetRoomById(r.Context(), roomId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		return change, "Choose a room", nil
+	}
+	if err != nil {
+		return change, "", err
+	}
+
+	if !room.Fits(res.Adults, res.Children) {
+		return change, tooSmall(room), nil
+	}
+
+	if room, err = m.withStayRules(r, room, startDate); err != nil {
+		return change, "", err
+	}
+	if err := room.CheckStay(startDate, endDate); err != nil {
+		return change, stayMessage(err), nil
+	}
+
+	if startDate.Equal(res.StartDate) && endDate.Equal(res.EndDate) && roomId == res.RoomId {
+		return change, "Your booking already has these dates and room", nil
+	}
+
+	// * The booking's own restrictions don't count against it, so a stay can be moved by a day or made longer
+	restrictions, err := m.DB.RoomRestrictionsBetween(r.Context(), roomId, startDate, endDate.AddDate(0, 0, m.App.CleaningDays))
+	if err != nil {
+		return change, "", err
+	}
+	var others []models.RoomRestriction
+	for _, rr := range restrictions {
+		if rr.ReservationId != res.ID {
+			others = append(others, rr)
+		}
+	}
+
+	holds, err := m.DB.RoomHoldsBetween(r.Context(), roomId, startDate.AddDate(0, 0, -m.App.CleaningDays), endDate.AddDate(0, 0, m.App.CleaningDays), m.holder(r))
+	if err != nil {
+		return change, "", err
+	}
+
+	finder := availability.Finder{
+		Restrictions: others,
+		Holds:        holds,
+		CleaningDays: m.App.CleaningDays,
+		Today:        today(),
+	}
+	if !finder.Free(room, startDate, endDate) {
+		return change, fmt.Sprintf("%s is not available for these dates", room.RoomName), nil
+	}
+
+	change.StartDate = startDate
+	change.EndDate = endDate
+	change.RoomId = roomId
+	change.Room = room
+	// * The booking keeps the rate plan it was made with, so its discount applies to the new price too
+	change.TotalPrice = change.PlanPrice(room.Price(change.Nights(), change.Adults, change.Children))
+
+	return change, "", nil
+}
+
+// depositDue: returns how much more is held on the guest's card to confirm change, 0 when the deposit doesn't grow
+// * A deposit which shrinks stays held as it is, the cancellation or the capture at check-in settles it
+func (m *Repository) depositDue(res, change models.Reservation) int {
+	if change.ID == 0 {
+		return 0
+	}
+	return max(0, m.deposit(change.TotalPrice)-m.deposit(res.TotalPrice))
+}
+
+// PostMyBooking: shows the new price of a change of dates or room to the booking, and makes the change once the guest confirms it
+func (m *Repository) PostMyBooking(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.bookingInSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if problem := changeProblem(reservation); problem != "" {
+		m.App.Session.Put(r.Context(), "error", problem)
+		http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+		return
+	}
+
+	// * The change is worked out again when it is confirmed, nothing but the dates and room is taken from the form
+	change, problem, err := m.bookingChange(r, reservation)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if problem != "" {
+		m.App.Session.Put(r.Context(), "error", problem)
+		http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+		return
+	}
+
+	if r.Form.Get("confirm") == "" {
+		m.renderBooking(w, r, reservation, change)
+		return
+	}
+
+	// * A guest's change is attributed to the email they booked with
+	actor := helpers.Actor(r)
+	if actor.Email == "" {
+		actor.Email = reservation.Email
+	}
+
+	// * A change costing more is only made once the rest of its deposit is held on the guest's card
+	auth, problem, err := m.authorizePayment(r, change, m.depositDue(reservation, change), r.Form.Get("payment_method"))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if problem != "" {
+		m.App.Session.Put(r.Context(), "error", problem)
+		m.renderBooking(w, r, reservation, change)
+		return
+	}
+
+	err = m.DB.ChangeReservation(r.Context(), change, m.authorizedPayment(auth), m.holder(r), actor)
+	if errors.Is(err, repository.ErrReservationCancelled) {
+		m.voidAuthorization(r, auth)
+		m.App.Session.Put(r.Context(), "error", "This booking has been cancelled")
+		http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.voidAuthorization(r, auth)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s has just been booked for these dates, please choose others", change.Room.RoomName))
+		http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.voidAuthorization(r, auth)
+		helpers.ServerError(w, r, err)
+		return
+	}
+	m.App.Session.Remove(r.Context(), "payment_key")
+
+	m.sendChangeEmails(reservation, change)
+
+	m.App.Session.Put(r.Context(), "flash", "Your booking has been changed")
+	http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+}
+
+// sendChangeEmails: tells the guest and the property owner that a booking moved from before to after
+func (m *Repository) sendChangeEmails(before, after models.Reservation) {
+	stay := func(res models.Reservation) string {
+		return html.EscapeString(res.Room.RoomName) + ` from ` + render.HumanDate(res.StartDate) + ` to ` + render.HumanDate(res.EndDate) + `, ` + render.Currency(res.TotalPrice)
+	}
+
+	htmlMsg := `
+		<strong>Reservation Changed</strong><br>
+		Dear ` + html.EscapeString(after.FirstName) + `, <br>
+		Your reservation ` + after.ConfirmationCode + ` has been changed to ` + stay(after) + `.<br>
+		It was ` + stay(before) + `.
+	`
+	m.App.MailChan <- models.MailData{
+		To:      after.Email,
+		From:    "Bed N'Breakfast <no-reply@bnb.com>",
+		Subject: "Reservation Changed",
+		Content: htmlMsg,
+	}
+
+	htmlMsg = `
+		<strong>Reservation Change Notification</strong><br>
+		The reservation ` + after.ConfirmationCode + ` of ` + html.EscapeString(after.FirstName) + ` ` + html.EscapeString(after.LastName) + ` has been changed to ` + stay(after) + `.<br>
+		It was ` + stay(before) + `.
+	`
+	m.App.MailChan <- models.MailData{
+		To:      "propertyowner@bnb.com",
+		From:    "Bed N'Breakfast <no-reply@bnb.com>",
+		Subject: "Reservation Change Notification",
+		Content: htmlMsg,
+	}
+}
+
+// PostCancelBooking: cancels the booking found with find-booking page, charging the fee of the policy it was booked with
+func (m *Repository) PostCancelBooking(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.bookingInSession(w, r)
+	if !ok {
+		return
+	}
+
+	if problem := changeProblem(reservation); problem != "" {
+		m.App.Session.Put(r.Context(), "error", problem)
+		http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+		return
+	}
+
+	// * A guest's cancellation is attributed to the email they booked with
+	actor := helpers.Actor(r)
+	if actor.Email == "" {
+		actor.Email = reservation.Email
+	}
+
+	fee := reservation.CancellationFeeOn(today())
+
+	err := m.DB.CancelReservation(r.Context(), reservation.ID, fee, actor)
+	if errors.Is(err, repository.ErrReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This booking has already been cancelled")
+		http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	reservation.CancellationFee = fee
+
+	// * The booking is cancelled either way, a payment left unsettled is fixed from the admin reservation page
+	if err := m.settlePayments(r.Context(), reservation, actor); err != nil {
+		m.logger(r).Error("cannot settle payments of cancelled reservation", "reservation_id", reservation.ID, "error", err)
+	}
+
+	m.sendCancellationEmails(reservation)
+
+	m.App.Session.Put(r.Context(), "flash", "Your booking has been cancelled")
+	http.Redirect(w, r, "/my-booking", http.StatusSeeOther)
+}
+
+// policyLine: describes the rate and cancellation policy of a reservation for emails
+func policyLine(res models.Reservation) string {
+	line := `Cancellation: ` + html.EscapeString(res.Policy.Description()) + `.<br>`
+	if res.RatePlanName != "" {
+		line = `Rate: ` + html.EscapeString(res.RatePlanName) + `.<br>` + line
+	}
+	return line
+}
+
+// depositLine: tells the guest what is held on their card for emails, empty when nothing is
+func depositLine(deposit int) string {
+	if deposit == 0 {
+		return ""
+	}
+	return `A deposit of ` + render.Currency(deposit) + ` is held on your card.<br>`
+}
+
+// sendCancellationEmails: tells the guest and the property owner that a booking was cancelled and what it cost
+func (m *Repository) sendCancellationEmails(res models.Reservation) {
+	fee := `free of charge`
+	if res.CancellationFee > 0 {
+		fee = `with a cancellation fee of ` + render.Currency(res.CancellationFee)
+	}
+
+	htmlMsg := `
+		<strong>Reservation Cancelled</strong><br>
+		Dear ` + html.EscapeString(res.FirstName) + `, <br>
+		Your reservation ` + res.ConfirmationCode + ` of ` + html.EscapeString(res.Room.RoomName) + ` from ` + render.HumanDate(res.StartDate) + ` to ` + render.HumanDate(res.EndDate) + ` has been cancelled ` + fee + `.
+	`
+	m.App.MailChan <- models.MailData{
+		To:      res.Email,
+		From:    "Bed N'Breakfast <no-reply@bnb.com>",
+		Subject: "Reservation Cancelled",
+		Content: htmlMsg,
+	}
+
+	htmlMsg = `
+		<strong>Reservation Cancellation Notification</strong><br>
+		The reservation ` + res.ConfirmationCode + ` of ` + html.EscapeString(res.FirstName) + ` ` + html.EscapeString(res.LastName) + ` from ` + render.HumanDate(res.StartDate) + ` to ` + render.HumanDate(res.EndDate) + ` has been cancelled ` + fee + `.
+	`
+	m.App.MailChan <- models.MailData{
+		To:      "propertyowner@bnb.com",
+		From:    "Bed N'Breakfast <no-reply@bnb.com>",
+		Subject: "Reservation Cancellation Notification",
+		Content: htmlMsg,
+	}
+}
+
+// AdminReservations: finds a reservation by the confirmation code query param and redirects to it, renders the search form when there is no code
+func (m *Repository) AdminReservations(w http.ResponseWriter, r *http.Request) {
+	input := r.URL.Query().Get("code")
+	form := forms.New(nil)
+
+	if input != "" {
+		code, ok := confirmationCode(input)
+		if !ok {
+			form.Errors.Add("code", "This is not a valid confirmation code")
+		} else {
+			id, err := m.DB.ReservationIdByCode(r.Context(), code)
+			if errors.Is(err, sql.ErrNoRows) {
+				form.Errors.Add("code", "No reservation has this confirmation code")
+			} else if err != nil {
+				helpers.ServerError(w, r, err)
+				return
+			} else {
+				http.Redirect(w, r, "/admin/reservations/"+strconv.Itoa(id), http.StatusSeeOther)
+				return
+			}
+		}
+	}
+
+	if err := render.Template(w, r, "admin-reservations.page.tmpl", &models.TemplateData{
+		Form:      form,
+		StringMap: map[string]string{"code": input},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// adminReservation: returns the reservation of the id url param, false after answering not found when there is none
+func (m *Repository) adminReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return models.Reservation{}, false
+	}
+
+	reservation, err := m.DB.GetReservationById(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return reservation, false
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return reservation, false
+	}
+
+	return reservation, true
+}
+
+// AdminReservation: shows a reservation with what cancelling it today costs
+func (m *Repository) AdminReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.adminReservation(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := m.DB.PaymentsByReservation(r.Context(), reservation.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := render.Template(w, r, "admin-reservation.page.tmpl", &models.TemplateData{
+		View: models.AdminReservationView{
+			Reservation: reservation,
+			Fee:         reservation.CancellationFeeOn(today()),
+			Payments:    list,
+		},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// PostAdminCancelReservation: cancels a reservation, charging the fee of its policy unless the admin waives it
+func (m *Repository) PostAdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.adminReservation(w, r)
+	if !ok {
+		return
+	}
+	back := "/admin/reservations/" + strconv.Itoa(reservation.ID)
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	fee := reservation.CancellationFeeOn(today())
+	if r.Form.Get("waive_fee") != "" {
+		fee = 0
+	}
+
+	err := m.DB.CancelReservation(r.Context(), reservation.ID, fee, helpers.Actor(r))
+	if errors.Is(err, repository.ErrReservationCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This reservation has already been cancelled")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	reservation.CancellationFee = fee
+
+	if err := m.settlePayments(r.Context(), reservation, helpers.Actor(r)); err != nil {
+		m.logger(r).Error("cannot settle payments of cancelled reservation", "reservation_id", reservation.ID, "error", err)
+		m.App.Session.Put(r.Context(), "warning", "Reservation cancelled, but its payments could not be settled: "+err.Error())
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Reservation cancelled")
+	}
+
+	m.sendCancellationEmails(reservation)
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
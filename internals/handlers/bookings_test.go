@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+func TestConfirmationCode(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		wantOk bool
+	}{
+		{"BNB-7K3Q9X", "BNB-7K3Q9X", true},
+		{" bnb 7k3q9x ", "BNB-7K3Q9X", true},
+		{"7k3q9x", "BNB-7K3Q9X", true},
+		{"bnb-7k3-q9x", "BNB-7K3Q9X", true},
+		{"7K3 Q9X", "BNB-7K3Q9X", true},
+		{"", "", false},
+		{"BNB-7K3Q9", "", false},
+		{"BNB-7K3Q9XX", "", false},
+		{"XYZ-7K3Q9X", "", false},
+		// * O, 0, I and 1 are left out of the alphabet as they are easily mistaken for each other
+		{"BNB-7K3Q9O", "", false},
+		{"BNB-7K3Q91", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := confirmationCode(tt.input)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("confirmationCode(%q) = %q, %t, want %q, %t", tt.input, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+// changeRepo: is a database with the rooms, restrictions and holds a booking change is checked against
+type changeRepo struct {
+	repository.DatabaseRepo
+	rooms        map[int]models.Room
+	restrictions []models.RoomRestriction
+	holds        []models.RoomHold
+}
+
+func (c changeRepo) GetRoomById(ctx context.Context, id int) (models.Room, error) {
+	room, ok := c.rooms[id]
+	if !ok {
+		return room, sql.ErrNoRows
+	}
+	return room, nil
+}
+
+func (c changeRepo) StayRules(ctx context.Context, roomId int, from time.Time) ([]models.StayRule, error) {
+	return nil, nil
+}
+
+func (c changeRepo) RoomRestrictionsBetween(ctx context.Context, roomId int, from, to time.Time) ([]models.RoomRestriction, error) {
+	return c.restrictions, nil
+}
+
+func (c changeRepo) RoomHoldsBetween(ctx context.Context, roomId int, from, to time.Time, holder string) ([]models.RoomHold, error) {
+	return c.holds, nil
+}
+
+func TestBookingChange(t *testing.T) {
+	day := func(n int) time.Time { return today().AddDate(0, 0, n) }
+	form := func(start, end, roomId int) url.Values {
+		return url.Values{"start": {day(start).Format("2006-01-02")}, "end": {day(end).Format("2006-01-02")}, "room_id": {strconv.Itoa(roomId)}}
+	}
+
+	// * The suite costs more than when the booking was made, a change is priced at the current rates
+	rooms := map[int]models.Room{
+		1: {ID: 1, RoomName: "Suite", Capacity: 4, Active: true, NightlyRate: 12000, IncludedGuests: 2, ExtraChildFee: 1000},
+		2: {ID: 2, RoomName: "Single", Capacity: 1, Active: true, NightlyRate: 5000, IncludedGuests: 1},
+		3: {ID: 3, RoomName: "Closed", Capacity: 4, Active: false, NightlyRate: 5000, IncludedGuests: 2},
+		4: {ID: 4, RoomName: "Family", Capacity: 4, Active: true, NightlyRate: 9000, IncludedGuests: 3},
+	}
+	booking := models.Reservation{ID: 7, RoomId: 1, StartDate: day(10), EndDate: day(12), Adults: 2, Children: 1, TotalPrice: 20000}
+	own := models.RoomRestriction{ReservationId: 7, RoomID: 1, StartDate: day(10), EndDate: day(12)}
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		restrictions []models.RoomRestriction
+		holds        []models.RoomHold
+		wantProblem  string
+		wantPrice    int
+	}{
+		{name: "longer stay at today's rate", form: form(10, 13, 1), restrictions: []models.RoomRestriction{own}, wantPrice: 3 * 13000},
+		{name: "other room", form: form(10, 12, 4), wantPrice: 2 * 9000},
+		{name: "same dates and room", form: form(10, 12, 1), wantProblem: "already has these dates"},
+		{name: "room too small", form: form(10, 12, 2), wantProblem: "sleeps up to 1 guest"},
+		{name: "inactive room", form: form(10, 12, 3), wantProblem: "Choose a room"},
+		{name: "unknown room", form: form(10, 12, 9), wantProblem: "Choose a room"},
+		{name: "reversed dates", form: form(12, 10, 1), wantProblem: "These dates can't be booked"},
+		{name: "booked by another guest", form: form(11, 14, 1), restrictions: []models.RoomRestriction{own, {ReservationId: 9, RoomID: 1, StartDate: day(13), EndDate: day(15)}}, wantProblem: "not available"},
+		{name: "held by another guest", form: form(10, 12, 4), holds: []models.RoomHold{{RoomID: 4, StartDate: day(11), EndDate: day(12)}}, wantProblem: "not available"},
+	}
+
+	session := scs.New()
+
+	for _, tt := range tests {
+		m := &Repository{
+			App: &config.AppConfig{Session: session},
+			DB:  changeRepo{rooms: rooms, restrictions: tt.restrictions, holds: tt.holds},
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/my-booking", strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx, err := session.Load(req.Context(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(ctx)
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+
+		change, problem, err := m.bookingChange(req, booking)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if tt.wantProblem != "" {
+			if !strings.Contains(problem, tt.wantProblem) {
+				t.Errorf("%s: problem is %q, want %q", tt.name, problem, tt.wantProblem)
+			}
+			continue
+		}
+		if problem != "" {
+			t.Errorf("%s: unexpected problem %q", tt.name, problem)
+			continue
+		}
+		if change.ID != booking.ID || change.TotalPrice != tt.wantPrice {
+			t.Errorf("%s: change is reservation %d priced %d, want %d priced %d", tt.name, change.ID, change.TotalPrice, booking.ID, tt.wantPrice)
+		}
+	}
+}
+
+func TestDepositDue(t *testing.T) {
+	booking := models.Reservation{ID: 7, TotalPrice: 20000}
+
+	tests := []struct {
+		name           string
+		depositPercent int
+		change         models.Reservation
+		want           int
+	}{
+		{name: "dearer change tops up the full deposit", depositPercent: 100, change: models.Reservation{ID: 7, TotalPrice: 26000}, want: 6000},
+		{name: "dearer change tops up part of the deposit", depositPercent: 30, change: models.Reservation{ID: 7, TotalPrice: 26000}, want: 1800},
+		{name: "top-up is rounded up to the cent", depositPercent: 30, change: models.Reservation{ID: 7, TotalPrice: 20001}, want: 1},
+		{name: "cheaper change holds nothing more", depositPercent: 100, change: models.Reservation{ID: 7, TotalPrice: 15000}, want: 0},
+		{name: "same price", depositPercent: 100, change: models.Reservation{ID: 7, TotalPrice: 20000}, want: 0},
+		{name: "no change yet", depositPercent: 100, want: 0},
+	}
+
+	for _, tt := range tests {
+		m := &Repository{App: &config.AppConfig{DepositPercent: tt.depositPercent}}
+		if got := m.depositDue(booking, tt.change); got != tt.want {
+			t.Errorf("%s: deposit due is %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
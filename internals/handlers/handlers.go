@@ -1,21 +1,30 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"html"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/imrcht/bed-n-breakfast/internals/availability"
 	"github.com/imrcht/bed-n-breakfast/internals/config"
 	"github.com/imrcht/bed-n-breakfast/internals/driver"
 	"github.com/imrcht/bed-n-breakfast/internals/forms"
 	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/payments"
 	"github.com/imrcht/bed-n-breakfast/internals/render"
 	"github.com/imrcht/bed-n-breakfast/internals/repository"
 	"github.com/imrcht/bed-n-breakfast/internals/repository/dbrepo"
@@ -24,18 +33,20 @@ import (
 
 // Repository
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App      *config.AppConfig
+	DB       repository.DatabaseRepo
+	Payments payments.PaymentGateway
 }
 
 // Repo
 var Repo *Repository
 
 // NewHandler
-func NewHandler(a *config.AppConfig, db *driver.DB) *Repository {
+func NewHandler(a *config.AppConfig, db *driver.DB, gateway payments.PaymentGateway) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgressDBRepo(a, db.SQL),
+		App:      a,
+		DB:       dbrepo.NewPostgressDBRepo(a, db.SQL),
+		Payments: gateway,
 	}
 }
 
@@ -44,6 +55,11 @@ func NewRepo(r *Repository) {
 	Repo = r
 }
 
+// logger: returns the logger of the current request, tagged with its request id
+func (m *Repository) logger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context(), m.App.Logger)
+}
+
 // * Receivers: Structs with functions
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 
@@ -51,7 +67,9 @@ func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	remoteIp := r.RemoteAddr
 	m.App.Session.Put(r.Context(), "remote_ip", remoteIp)
 
-	render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "home.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
@@ -63,22 +81,19 @@ func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
 	remoteIp := m.App.Session.GetString(r.Context(), "remote_ip")
 
 	mapString["remote_ip"] = remoteIp
-	render.Template(w, r, "about.page.tmpl", &models.TemplateData{
+	if err := render.Template(w, r, "about.page.tmpl", &models.TemplateData{
 		StringMap: mapString,
-	})
-}
-
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	// * Fetch the room id of generals room page from database and pass it to template data as a string map
-	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
-}
-
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+		View: models.SearchAvailabilityView{},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 type jsonResponse struct {
@@ -87,50 +102,271 @@ type jsonResponse struct {
 	RoomId    string `json:"room_id"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
+	Adults    int    `json:"adults"`
+	Children  int    `json:"children"`
+	Price     string `json:"price"`
+
+	// * Set when the room can't be booked and other dates or rooms were found
+	Suggestions *jsonSuggestions `json:"suggestions,omitempty"`
 }
 
-// AvailabilityJSON: handles request for availability and send response in json format
-func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
+type jsonSuggestions struct {
+	Earlier   []jsonStay `json:"earlier"`
+	Later     []jsonStay `json:"later"`
+	SplitStay []jsonStay `json:"split_stay"`
+}
 
+type jsonStay struct {
+	RoomId    int    `json:"room_id"`
+	RoomName  string `json:"room_name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Price     string `json:"price"`
+	BookURL   string `json:"book_url"`
+}
+
+// newJSONSuggestions: converts suggestions for a party of adults and children, with the price and booking link of each stay
+func newJSONSuggestions(suggestions models.Suggestions, adults, children int) *jsonSuggestions {
+	stays := func(options []models.StayOption) []jsonStay {
+		out := []jsonStay{}
+		for _, o := range options {
+			bookURL, _ := render.URL("/book-room", "id", o.Room.ID, "s", render.HumanDate(o.StartDate), "e", render.HumanDate(o.EndDate), "a", adults, "c", children)
+			out = append(out, jsonStay{
+				RoomId:    o.Room.ID,
+				RoomName:  o.Room.RoomName,
+				StartDate: render.HumanDate(o.StartDate),
+				EndDate:   render.HumanDate(o.EndDate),
+				Price:     render.Currency(o.Room.Price(o.Nights(), adults, children)),
+				BookURL:   bookURL,
+			})
+		}
+		return out
+	}
+
+	return &jsonSuggestions{
+		Earlier:   stays(suggestions.Earlier),
+		Later:     stays(suggestions.Later),
+		SplitStay: stays(suggestions.SplitStay),
+	}
+}
+
+// guestsFromForm: validates the adults and children fields, a missing field counts as one adult and no children
+func guestsFromForm(form *forms.Form) (adults, children int) {
+	if form.Get("adults") == "" {
+		form.Set("adults", "1")
+	}
+	if form.Get("children") == "" {
+		form.Set("children", "0")
+	}
+
+	form.IsIntBetween("adults", 1, maxRoomCapacity)
+	form.IsIntBetween("children", 0, maxRoomCapacity)
+
+	adults, _ = strconv.Atoi(strings.TrimSpace(form.Get("adults")))
+	children, _ = strconv.Atoi(strings.TrimSpace(form.Get("children")))
+
+	return adults, children
+}
+
+// tooSmall: is the message shown when a party doesn't fit in a room
+func tooSmall(room models.Room) string {
+	return fmt.Sprintf("%s sleeps up to %d %s", room.RoomName, room.Capacity, render.Pluralize(room.Capacity, "guest", "guests"))
+}
+
+// * Longest stay accepted by search and booking, stay rules can only make it shorter
+const maxStayNights = 365
+
+// stayDates: parses the arrival and departure of a search, the error says what is wrong with them
+func stayDates(start, end string) (time.Time, time.Time, error) {
 	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, sd)
+	startDate, err1 := time.Parse(layout, start)
+	endDate, err2 := time.Parse(layout, end)
+	if err1 != nil || err2 != nil {
+		return startDate, endDate, errors.New("choose an arrival and a departure date")
+	}
+
+	if !endDate.After(startDate) {
+		return startDate, endDate, errors.New("departure must be after arrival")
+	}
+
+	if startDate.Before(today()) {
+		return startDate, endDate, errors.New("arrival can't be in the past")
+	}
+
+	if endDate.Sub(startDate) > maxStayNights*24*time.Hour {
+		return startDate, endDate, fmt.Errorf("stays are limited to %d nights", maxStayNights)
+	}
+
+	return startDate, endDate, nil
+}
+
+// stayMessage: is the message shown when dates can't be booked
+func stayMessage(err error) string {
+	return "These dates can't be booked, " + err.Error()
+}
+
+// attachStayRules: gives each room its rules out of rules
+func attachStayRules(rooms []models.Room, rules []models.StayRule) {
+	for i := range rooms {
+		for _, rule := range rules {
+			if rule.RoomID == rooms[i].ID {
+				rooms[i].StayRules = append(rooms[i].StayRules, rule)
+			}
+		}
+	}
+}
+
+// suggest: looks for other dates and split stays, among the rooms the party fits in, when start to end can't be booked
+func (m *Repository) suggest(r *http.Request, start, end time.Time, adults, children int) (models.Suggestions, error) {
+	var suggestions models.Suggestions
+
+	from := start.AddDate(0, 0, -availability.Horizon)
+	if from.Before(today()) {
+		from = today()
+	}
+	nights := int(end.Sub(start).Hours() / 24)
+	to := end.AddDate(0, 0, availability.Horizon+nights+m.App.CleaningDays)
+
+	rooms, err := m.DB.AllRooms(r.Context(), true)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return suggestions, err
 	}
 
-	endDate, err := time.Parse(layout, ed)
+	restrictions, err := m.DB.RoomRestrictionsBetween(r.Context(), 0, from, to)
 	if err != nil {
-		helpers.ServerError(w, err)
+		return suggestions, err
+	}
+
+	holds, err := m.DB.RoomHoldsBetween(r.Context(), 0, from, to, m.holder(r))
+	if err != nil {
+		return suggestions, err
+	}
+
+	rules, err := m.DB.StayRules(r.Context(), 0, from)
+	if err != nil {
+		return suggestions, err
+	}
+
+	var fitting []models.Room
+	for _, room := range rooms {
+		if room.Fits(adults, children) {
+			fitting = append(fitting, room)
+		}
+	}
+	attachStayRules(fitting, rules)
+
+	finder := availability.Finder{
+		Rooms:        fitting,
+		Restrictions: restrictions,
+		Holds:        holds,
+		CleaningDays: m.App.CleaningDays,
+		Today:        today(),
+	}
+
+	return finder.Suggest(start, end), nil
+}
+
+// withStayRules: loads the stay rules of the room ending on or after from
+func (m *Repository) withStayRules(r *http.Request, room models.Room, from time.Time) (models.Room, error) {
+	rules, err := m.DB.StayRules(r.Context(), room.ID, from)
+	room.StayRules = rules
+	return room, err
+}
+
+// AvailabilityJSON: handles request for availability and send response in json format
+func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
 		return
 	}
 
+	sd := r.Form.Get("start")
+	ed := r.Form.Get("end")
+
 	roomId, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	isAvailable, err := m.DB.SearchAvailabilityByDatesByRoomId(startDate, endDate, roomId)
+	form := forms.New(r.Form)
+	adults, children := guestsFromForm(form)
+	if !form.Valid() {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	room, err := m.DB.GetRoomById(r.Context(), roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	respStruct := jsonResponse{
-		Ok:        isAvailable,
 		Message:   " ",
 		RoomId:    strconv.Itoa(roomId),
 		StartDate: sd,
 		EndDate:   ed,
+		Adults:    adults,
+		Children:  children,
 	}
 
-	respJson, err := json.MarshalIndent(respStruct, "", "  ")
+	startDate, endDate, err := stayDates(sd, ed)
+	if err != nil {
+		respStruct.Message = stayMessage(err)
+		m.writeJSON(w, r, respStruct)
+		return
+	}
 
+	isAvailable, err := m.DB.SearchAvailabilityByDatesByRoomId(r.Context(), startDate, endDate, roomId, m.holder(r))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
+		return
+	}
+	respStruct.Ok = isAvailable
+
+	room, err = m.withStayRules(r, room, startDate)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// * A room which is free but too small for the party, or whose stay rules refuse the dates, isn't offered
+	if !room.Fits(adults, children) {
+		respStruct.Ok = false
+		respStruct.Message = tooSmall(room)
+	} else if err := room.CheckStay(startDate, endDate); err != nil {
+		respStruct.Ok = false
+		respStruct.Message = stayMessage(err)
+	}
+
+	if respStruct.Ok {
+		nights := int(endDate.Sub(startDate).Hours() / 24)
+		respStruct.Price = render.Currency(room.Price(nights, adults, children))
+	} else {
+		suggestions, err := m.suggest(r, startDate, endDate, adults, children)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		if suggestions.Any() {
+			respStruct.Suggestions = newJSONSuggestions(suggestions, adults, children)
+		}
+	}
+
+	m.writeJSON(w, r, respStruct)
+}
+
+// writeJSON: sends v as indented json
+func (m *Repository) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	respJson, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -140,50 +376,319 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 // PostAvailability: handles request for availability and redirects to choose-room page
 func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
 
-	// * 2001-01-01 --> 01/02 03:04:05PM '06 -0700
-	// * Layout is the format of the date
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
+	// * Dates are in the 2006-01-02 layout
+	startDate, endDate, err := stayDates(r.Form.Get("start"), r.Form.Get("end"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Session.Put(r.Context(), "error", stayMessage(err))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
-		helpers.ServerError(w, err)
+	form := forms.New(r.PostForm)
+	adults, children := guestsFromForm(form)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Choose at least one adult")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
-	availableRooms, err := m.DB.SearchAvailabilityForAllRoomsByDates(startDate, endDate)
+	availableRooms, err := m.DB.SearchAvailabilityForAllRoomsByDates(r.Context(), startDate, endDate, adults+children, m.holder(r))
 
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	if len(availableRooms) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No available rooms")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	rules, err := m.DB.StayRules(r.Context(), 0, startDate)
+	if err != nil {
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["rooms"] = availableRooms
+	// * Rooms whose stay rules refuse the dates are left out, the first reason is shown when no room is left
+	attachStayRules(availableRooms, rules)
+
+	var ruleErr error
+	bookable := availableRooms[:0]
+	for _, room := range availableRooms {
+		if err := room.CheckStay(startDate, endDate); err != nil {
+			if ruleErr == nil {
+				ruleErr = err
+			}
+			continue
+		}
+		bookable = append(bookable, room)
+	}
+	availableRooms = bookable
 
 	// * Store reservation details in session so that it can be used in next page
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+	}
+
+	if len(availableRooms) == 0 {
+		metrics.EmptySearches.Inc()
+		if ruleErr != nil {
+			m.App.Session.Put(r.Context(), "error", stayMessage(ruleErr))
+		} else {
+			m.App.Session.Put(r.Context(), "error", "No available rooms")
+		}
+
+		suggestions, err := m.suggest(r, startDate, endDate, adults, children)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		if !suggestions.Any() {
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		// * The search page is shown again with the suggestions, the error is popped by the render
+		if err := render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+			View: models.SearchAvailabilityView{Reservation: res, Suggestions: suggestions},
+		}); err != nil {
+			helpers.ServerError(w, r, err)
+		}
+		return
 	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
-		Data: data,
+	if err := render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
+		View: models.ChooseRoomView{Rooms: availableRooms, Reservation: res},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// * Longest window a flexible search may cover, which bounds the rows it returns
+const maxFlexibleWindowDays = 62
+
+// flexibleWindow: returns the window of a flexible search from a month such as 2026-03, or else from a start and end date, starting today at the earliest
+func flexibleWindow(month, start, end string) (time.Time, time.Time, error) {
+	var from, to time.Time
+
+	if month != "" {
+		first, err := time.Parse("2006-01", month)
+		if err != nil {
+			return from, to, errors.New("choose a month")
+		}
+		from, to = first, first.AddDate(0, 1, 0)
+	} else {
+		layout := "2006-01-02"
+		var err1, err2 error
+		from, err1 = time.Parse(layout, start)
+		to, err2 = time.Parse(layout, end)
+		if err1 != nil || err2 != nil {
+			return from, to, errors.New("choose a month or the first and last day of your window")
+		}
+		// * The last day of the window is a possible departure
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if from.Before(today()) {
+		from = today()
+	}
+	if !to.After(from) {
+		return from, to, errors.New("the window is in the past")
+	}
+	if to.Sub(from) > maxFlexibleWindowDays*24*time.Hour {
+		return from, to, fmt.Errorf("the window can be at most %d days", maxFlexibleWindowDays)
+	}
+
+	return from, to, nil
+}
+
+// PostFlexibleAvailability: lists every room and arrival date for a stay of a given length within a month or date window, cheapest first
+func (m *Repository) PostFlexibleAvailability(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	adults, children := guestsFromForm(form)
+	form.IsIntBetween("nights", 1, maxStayNights)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Choose at least one adult and a stay of 1 to %d nights", maxStayNights))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	nights, _ := strconv.Atoi(strings.TrimSpace(form.Get("nights")))
+
+	from, to, err := flexibleWindow(form.Get("month"), form.Get("window_start"), form.Get("window_end"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "These dates can't be searched, "+err.Error())
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	options, err := m.DB.SearchFlexibleAvailability(r.Context(), from, to, nights, adults+children, m.holder(r))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rules, err := m.DB.StayRules(r.Context(), 0, from)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// * Stay rules are checked here, the query only knows about restrictions
+	bookable := options[:0]
+	for _, option := range options {
+		rooms := []models.Room{option.Room}
+		attachStayRules(rooms, rules)
+		option.Room = rooms[0]
+
+		if option.Room.CheckStay(option.StartDate, option.EndDate) == nil {
+			bookable = append(bookable, option)
+		}
+	}
+	options = bookable
+
+	if len(options) == 0 {
+		metrics.EmptySearches.Inc()
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("No room is free for %d %s between %s and %s",
+			nights, render.Pluralize(nights, "night", "nights"), render.HumanDate(from), render.HumanDate(to)))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// * Cheapest first, the query already ordered by arrival and room name which the stable sort keeps for equal prices
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Room.Price(nights, adults, children) < options[j].Room.Price(nights, adults, children)
 	})
+
+	if err := render.Template(w, r, "flexible-results.page.tmpl", &models.TemplateData{
+		View: models.FlexibleResultsView{
+			Reservation: models.Reservation{Adults: adults, Children: children},
+			From:        from,
+			To:          to,
+			Nights:      nights,
+			Options:     options,
+		},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// * Most months the availability calendar returns in one request
+const maxCalendarMonths = 12
+
+type jsonCalendar struct {
+	RoomId    int               `json:"room_id"`
+	StartDate string            `json:"start_date"`
+	EndDate   string            `json:"end_date"`
+	Days      []jsonCalendarDay `json:"days"`
+}
+
+type jsonCalendarDay struct {
+	Date   string `json:"date"`
+	Status string `json:"status"`
+	// * Nightly price for the party, only on days a stay can start
+	Price string `json:"price,omitempty"`
+}
+
+// AvailabilityCalendar: returns the status and nightly price of a room on each day of one or more months, for date pickers
+// * Takes room_id, month such as 2026-03 defaulting to the current month, months from 1 to 12 defaulting to 1, adults and children
+func (m *Repository) AvailabilityCalendar(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	adults, children := guestsFromForm(form)
+	if form.Get("months") == "" {
+		form.Set("months", "1")
+	}
+	form.IsIntBetween("months", 1, maxCalendarMonths)
+	if !form.Valid() {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+	months, _ := strconv.Atoi(form.Get("months"))
+
+	roomId, err := strconv.Atoi(form.Get("room_id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	start := today().AddDate(0, 0, 1-today().Day())
+	if month := form.Get("month"); month != "" {
+		start, err = time.Parse("2006-01", month)
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+	end := start.AddDate(0, months, 0)
+
+	room, err := m.DB.GetRoomById(r.Context(), roomId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// * Whether a day is an arrival or a departure depends on stays reaching up to Horizon days either side
+	from := start.AddDate(0, 0, -availability.Horizon)
+	room, err = m.withStayRules(r, room, from)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	to := end.AddDate(0, 0, availability.Horizon+m.App.CleaningDays)
+	restrictions, err := m.DB.RoomRestrictionsBetween(r.Context(), roomId, from, to)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	holds, err := m.DB.RoomHoldsBetween(r.Context(), roomId, from, to, m.holder(r))
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	finder := availability.Finder{
+		Rooms:        []models.Room{room},
+		Restrictions: restrictions,
+		Holds:        holds,
+		CleaningDays: m.App.CleaningDays,
+		Today:        today(),
+	}
+
+	calendar := jsonCalendar{
+		RoomId:    roomId,
+		StartDate: render.HumanDate(start),
+		EndDate:   render.HumanDate(end.AddDate(0, 0, -1)),
+		Days:      []jsonCalendarDay{},
+	}
+
+	// * A party the room can't take has nothing to book, every day keeps its status but none gets a price
+	fits := room.Fits(adults, children)
+	for _, day := range finder.Calendar(room, start, end) {
+		d := jsonCalendarDay{Date: render.HumanDate(day.Date), Status: day.Status}
+		if fits && day.Bookable() {
+			d.Price = render.Currency(room.NightlyPrice(adults, children))
+		}
+		calendar.Days = append(calendar.Days, d)
+	}
+
+	m.writeJSON(w, r, calendar)
 }
 
 // SelectRoom: takes room id as url param, stores it in session and redirects to make-reservation page
@@ -191,7 +696,7 @@ func (m *Repository) SelectRoom(w http.ResponseWriter, r *http.Request) {
 	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
 
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -199,46 +704,68 @@ func (m *Repository) SelectRoom(w http.ResponseWriter, r *http.Request) {
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 
 	if !ok {
-		m.App.ErrorLog.Println("Cannot get reservation from session")
+		m.logger(r).Warn("cannot get reservation from session")
 		m.App.Session.Put(r.Context(), "error", "Cannot get reservation from session")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	res.RoomId = roomId
+
+	held, err := m.holdRoom(r, res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", "Another guest has just taken this room, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
-// BookRoom: takes room id, start date and end date as query params, stores it in session and redirects to make-reservation page
+// BookRoom: takes room id, start date, end date and guests as query params, stores it in session and redirects to make-reservation page
 func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	roomId, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
-
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, sd)
-	if err != nil {
-		helpers.ServerError(w, err)
+	// * Links made before guests were counted have no a and c params, they book for one adult
+	form := forms.New(url.Values{"adults": {r.URL.Query().Get("a")}, "children": {r.URL.Query().Get("c")}})
+	adults, children := guestsFromForm(form)
+	if !form.Valid() {
+		helpers.ClientError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	endDate, err := time.Parse(layout, ed)
+	// * Fetch room details from DB, a room taken out of the catalogue can't be booked
+	room, err := m.DB.GetRoomById(r.Context(), roomId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	// * Fetch room details from DB
-	room, err := m.DB.GetRoomById(roomId)
+	startDate, endDate, err := stayDates(r.URL.Query().Get("s"), r.URL.Query().Get("e"))
+	if err == nil {
+		if room, err = m.withStayRules(r, room, startDate); err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		err = room.CheckStay(startDate, endDate)
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.App.Session.Put(r.Context(), "error", stayMessage(err))
+		http.Redirect(w, r, "/rooms/"+room.Slug, http.StatusSeeOther)
 		return
 	}
 
@@ -247,14 +774,30 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		EndDate:   endDate,
 		RoomId:    roomId,
 		Room:      room,
+		Adults:    adults,
+		Children:  children,
 	}
+
+	held, err := m.holdRoom(r, res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", "These dates are booked or another guest is booking them, please choose other dates")
+		http.Redirect(w, r, "/rooms/"+room.Slug, http.StatusSeeOther)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
 func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "contact.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // Reservation: takes reservations details from session and renders make-reservation page
@@ -264,53 +807,97 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 
 	if !ok {
-		m.App.ErrorLog.Println("Cannot get reservation from session")
-		helpers.ServerError(w, errors.New("cannot get reservation from session"))
+		m.logger(r).Warn("cannot get reservation from session")
+		helpers.ServerError(w, r, errors.New("cannot get reservation from session"))
 		return
 	}
 
-	sd := res.StartDate.Format("2006-01-02")
-	ed := res.EndDate.Format("2006-01-02")
 	roomId := res.RoomId
 
-	// * Fetch room details from DB
-	room, err := m.DB.GetRoomById(roomId)
+	// * Fetch room details from DB, a room taken out of the catalogue can't be booked
+	room, err := m.DB.GetRoomById(r.Context(), roomId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// * The room may have been chosen by editing the url, so its size and stay rules are checked again
+	if !room.Fits(res.Adults, res.Children) {
+		m.App.Session.Put(r.Context(), "error", tooSmall(room))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	room, err = m.withStayRules(r, room, res.StartDate)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := room.CheckStay(res.StartDate, res.EndDate); err != nil {
+		m.App.Session.Put(r.Context(), "error", stayMessage(err))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
 	res.Room = room
+	// * The price is fixed when the guest sees it, a rate changed before they submit doesn't change it
+	// * It stays the price before the discount of a rate plan, which is only applied once the guest has picked one
+	res.TotalPrice = room.Price(res.Nights(), res.Adults, res.Children)
+
+	plans, err := m.DB.RatePlans(r.Context(), roomId)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
 	// * Store reservation details in session so that it can be used in next page
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	strmap := make(map[string]string)
-	strmap["start_date"] = sd
-	strmap["end_date"] = ed
-	strmap["room_name"] = room.RoomName
+	view := models.MakeReservationView{Reservation: res, HeldUntil: m.heldUntil(r), RatePlans: plans, DepositPercent: m.App.DepositPercent}
+	if len(plans) > 0 {
+		view.RatePlanID = plans[0].ID
+	}
 
-	// * interface is a type that can hold any type of data where `{}` represents empty data for any type
-	data := make(map[string]interface{})
-	data["reservation"] = res
+	if err := render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		View: view,
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
 
-	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-		Form:      forms.New(nil),
-		Data:      data,
-		StringMap: strmap,
-	})
+// ratePlanFromForm: returns the rate plan picked on the reservation form among the plans of the room, false when none of them was picked
+func ratePlanFromForm(r *http.Request, plans []models.RatePlan) (models.RatePlan, bool) {
+	id, err := strconv.Atoi(r.Form.Get("rate_plan_id"))
+	if err != nil {
+		return models.RatePlan{}, false
+	}
+
+	for _, plan := range plans {
+		if plan.ID == id {
+			return plan, true
+		}
+	}
+
+	return models.RatePlan{}, false
 }
 
 // PostReservation: takes reservation details from form, checks whether room is available or not, validates form, add the record to reservation and room restriction table and redirects to reservation-summary page
 func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.ErrorLog.Println("Cannot get reservation from session")
+		m.logger(r).Warn("cannot get reservation from session")
 		m.App.Session.Put(r.Context(), "error", "cannot get reservation from session")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
@@ -324,10 +911,10 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	// startDate, err := time.Parse(layout, sd)
 
 	// * Check if room is available
-	roomAvailabilityStatus, err := m.DB.SearchAvailabilityByDatesByRoomId(reservation.StartDate, reservation.EndDate, reservation.RoomId)
+	roomAvailabilityStatus, err := m.DB.SearchAvailabilityByDatesByRoomId(r.Context(), reservation.StartDate, reservation.EndDate, reservation.RoomId, m.holder(r))
 
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -354,45 +941,88 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	form.IsValidEmail("email", r)
 	form.IsValidPhone("phone", r)
 
-	if !form.Valid() {
-		data := make(map[string]interface{})
+	// * Rooms without rate plans are booked at their rates with nothing charged on cancellation
+	plans, err := m.DB.RatePlans(r.Context(), reservation.RoomId)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-		data["reservation"] = reservation
+	plan, picked := ratePlanFromForm(r, plans)
+	if len(plans) > 0 && !picked {
+		form.Errors.Add("rate_plan_id", "Choose a rate")
+	}
 
-		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+	// * The plan and its policy are copied onto the reservation, so later changes to them don't affect it
+	// * The session keeps the price before the discount, the form may be shown again with another plan picked
+	booked := reservation
+	if picked {
+		booked.RatePlanName = plan.Name
+		booked.DiscountPercent = plan.DiscountPercent
+		booked.Policy = plan.Policy
+		booked.TotalPrice = plan.Price(reservation.TotalPrice)
+	}
 
-		return
+	// * The reservation is only made once its deposit is held on the guest's card
+	var auth payments.Authorization
+	if form.Valid() {
+		var problem string
+		auth, problem, err = m.authorizePayment(r, booked, m.deposit(booked.TotalPrice), form.Get("payment_method"))
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		if problem != "" {
+			form.Errors.Add("payment_method", problem)
+		}
 	}
 
-	reservationId, err := m.DB.InsertReservation(reservation)
-	if err != nil {
-		helpers.ServerError(w, err)
+	if !form.Valid() {
+		if err := render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+			Form: form,
+			View: models.MakeReservationView{Reservation: reservation, HeldUntil: m.heldUntil(r), RatePlans: plans, RatePlanID: plan.ID, DepositPercent: m.App.DepositPercent},
+		}); err != nil {
+			helpers.ServerError(w, r, err)
+		}
+
 		return
 	}
-	reservation.ID = reservationId
 
-	roomRestriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		ReservationId: reservationId,
-		RoomID:        reservation.RoomId,
-		RestrictionID: 3,
+	// * A guest booking is attributed to the email they booked with
+	actor := helpers.Actor(r)
+	if actor.Email == "" {
+		actor.Email = booked.Email
 	}
 
-	err = m.DB.InsertRoomRestriction(roomRestriction)
+	// * The room is checked again while it is locked, another guest may have booked it since
+	// * Whatever stops the reservation from being made releases the money held for it
+	holder := m.holder(r)
+	reservation, err = m.DB.BookReservation(r.Context(), booked, m.authorizedPayment(auth), holder, actor)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.voidAuthorization(r, auth)
+		m.App.Session.Put(r.Context(), "error", "Selected room is not available")
+		http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		m.voidAuthorization(r, auth)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
+	m.App.Session.Remove(r.Context(), "payment_key")
+	if holder != "" {
+		m.App.Session.Remove(r.Context(), "held_until")
+	}
+
 	// * Send notification to guest
 	htmlMsg := `
 		<strong>Reservation Confirmation</strong><br>
 		Dear ` + html.EscapeString(reservation.FirstName) + `, <br>
-		This is to confirm your reservation from ` + reservation.StartDate.Format("2006-01-02") + ` to ` + reservation.EndDate.Format("2006-01-02") + `.
+		This is to confirm your reservation from ` + render.HumanDate(reservation.StartDate) + ` to ` + render.HumanDate(reservation.EndDate) + `
+		for ` + strconv.Itoa(reservation.Guests()) + ` ` + render.Pluralize(reservation.Guests(), "guest", "guests") + `, the total is ` + render.Currency(reservation.TotalPrice) + `.<br>
+		` + policyLine(reservation) + depositLine(m.deposit(reservation.TotalPrice)) + `
+		Your confirmation code is <strong>` + reservation.ConfirmationCode + `</strong>, use it with your email to find your booking at /find-booking.
 	`
 	msg := models.MailData{
 		To:      reservation.Email,
@@ -405,7 +1035,8 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	// * Send notification to property owner
 	htmlMsg = `
 		<strong>Reservation Notification</strong><br>
-		A reservation has been made for ` + reservation.FirstName + ` ` + reservation.LastName + ` from ` + reservation.StartDate.Format("2006-01-02") + ` to ` + reservation.EndDate.Format("2006-01-02") + `.
+		A reservation has been made for ` + html.EscapeString(reservation.FirstName) + ` ` + html.EscapeString(reservation.LastName) + ` from ` + render.HumanDate(reservation.StartDate) + ` to ` + render.HumanDate(reservation.EndDate) + `,
+		confirmation code ` + reservation.ConfirmationCode + `.
 	`
 	msg = models.MailData{
 		To:      "propertyowner@bnb.com",
@@ -424,31 +1055,28 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 
 	if !ok {
-		m.App.ErrorLog.Println("Reservation not found in session")
+		m.logger(r).Warn("reservation not found in session")
 		m.App.Session.Put(r.Context(), "flash", "Reservation not found ")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
 	m.App.Session.Remove(r.Context(), "reservation")
-	data := make(map[string]interface{})
 
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = reservation.StartDate.Format("2006-01-02")
-	stringMap["end_date"] = reservation.EndDate.Format("2006-01-02")
-
-	data["reservation"] = reservation
-	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
-	})
+	if err := render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
+		View: models.ReservationSummaryView{Reservation: reservation, Deposit: m.deposit(reservation.TotalPrice)},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // ShowLogin: renders login page
 func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+	if err := render.Template(w, r, "login.page.tmpl", &models.TemplateData{
 		Form: forms.New(nil),
-	})
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
 
 // PostShowLogin: takes login details from form, validates form, authenticate user and redirects to dashboard page
@@ -458,7 +1086,7 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logger(r).Error("cannot parse login form", "error", err)
 	}
 
 	form := forms.New(r.PostForm)
@@ -469,22 +1097,24 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 	password := r.Form.Get("password")
 
 	if !form.Valid() {
-		m.App.ErrorLog.Println("Invalid form details")
-		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		m.logger(r).Info("invalid login form details")
+		if err := render.Template(w, r, "login.page.tmpl", &models.TemplateData{
 			Form: form,
 			StringMap: map[string]string{
 				"email":    email,
 				"password": password,
 			},
-		})
+		}); err != nil {
+			helpers.ServerError(w, r, err)
+		}
 		return
 	}
 
 	// * Authenticate user
-	user, _, err := m.DB.Authenticate(email, password)
+	user, _, err := m.DB.Authenticate(r.Context(), email, password, helpers.Actor(r))
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Invalid login details")
-		m.App.ErrorLog.Println("Invalid login details")
+		m.logger(r).Info("invalid login details", "email", email)
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
@@ -504,8 +1134,7 @@ type jsonResponseSignup struct {
 func (m *Repository) PostSignUpJson(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		m.App.ErrorLog.Println(err)
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 	}
 
 	type UserBody struct {
@@ -520,14 +1149,12 @@ func (m *Repository) PostSignUpJson(w http.ResponseWriter, r *http.Request) {
 	var userBody UserBody
 	err = json.Unmarshal(reqBody, &userBody)
 	if err != nil {
-		m.App.ErrorLog.Println(err)
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 	}
-	log.Println(userBody.Email)
 
 	// TODO: Validate userBody
 	if userBody.Password != userBody.ConfirmPassword {
-		m.App.ErrorLog.Println("Password and confirm password does not match")
+		m.logger(r).Info("password and confirm password does not match")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnprocessableEntity)
 		json.NewEncoder(w).Encode(jsonResponseSignup{
@@ -544,12 +1171,17 @@ func (m *Repository) PostSignUpJson(w http.ResponseWriter, r *http.Request) {
 		LastName:    userBody.LastName,
 		Email:       userBody.Email,
 		Password:    string(hashedPassword),
-		AccessLevel: 2,
+		AccessLevel: models.AccessLevelUser,
 	}
 
-	user, err = m.DB.InsertUser(user)
+	actor := helpers.Actor(r)
+	if actor.Email == "" {
+		actor.Email = user.Email
+	}
+
+	user, err = m.DB.InsertUser(r.Context(), user, actor)
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logger(r).Error("cannot insert user", "email", user.Email, "error", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnprocessableEntity)
 		json.NewEncoder(w).Encode(jsonResponseSignup{
@@ -577,5 +1209,57 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// AdminAudit: renders the audit log, filtered by the entity, action, actor, from and to query params
+func (m *Repository) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := models.AuditFilter{
+		Entity: query.Get("entity"),
+		Action: query.Get("action"),
+		Actor:  query.Get("actor"),
+	}
+
+	layout := "2006-01-02"
+	if from := query.Get("from"); from != "" {
+		fromDate, err := time.Parse(layout, from)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Invalid from date")
+			http.Redirect(w, r, "/admin/audit", http.StatusSeeOther)
+			return
+		}
+		filter.From = fromDate
+	}
+
+	if to := query.Get("to"); to != "" {
+		toDate, err := time.Parse(layout, to)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Invalid to date")
+			http.Redirect(w, r, "/admin/audit", http.StatusSeeOther)
+			return
+		}
+		// * The to date is inclusive so the whole day is covered
+		filter.To = toDate.AddDate(0, 0, 1)
+	}
+
+	entries, err := m.DB.AllAuditEntries(r.Context(), filter)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := render.Template(w, r, "admin-audit.page.tmpl", &models.TemplateData{
+		View: models.AdminAuditView{
+			Entries: entries,
+			Filter:  filter,
+			From:    query.Get("from"),
+			To:      query.Get("to"),
+		},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
 }
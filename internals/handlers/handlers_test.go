@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlexibleWindow(t *testing.T) {
+	layout := "2006-01-02"
+	nextMonth := time.Date(today().Year(), today().Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	lastMonth := time.Date(today().Year(), today().Month()-1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		month    string
+		start    string
+		end      string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "a month", month: nextMonth.Format("2006-01"), wantFrom: nextMonth, wantTo: nextMonth.AddDate(0, 1, 0)},
+		{name: "a month over dates", month: nextMonth.Format("2006-01"), start: "x", end: "y", wantFrom: nextMonth, wantTo: nextMonth.AddDate(0, 1, 0)},
+		{name: "not a month", month: "March", wantErr: true},
+		{name: "a past month", month: lastMonth.Format("2006-01"), wantErr: true},
+		{
+			name:     "dates include the last day as a departure",
+			start:    today().AddDate(0, 0, 3).Format(layout),
+			end:      today().AddDate(0, 0, 10).Format(layout),
+			wantFrom: today().AddDate(0, 0, 3),
+			wantTo:   today().AddDate(0, 0, 11),
+		},
+		{
+			name:     "starts today at the earliest",
+			start:    today().AddDate(0, 0, -3).Format(layout),
+			end:      today().AddDate(0, 0, 3).Format(layout),
+			wantFrom: today(),
+			wantTo:   today().AddDate(0, 0, 4),
+		},
+		{name: "missing end", start: today().Format(layout), wantErr: true},
+		{name: "too long", start: today().Format(layout), end: today().AddDate(0, 0, maxFlexibleWindowDays).Format(layout), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := flexibleWindow(tt.month, tt.start, tt.end)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s to %s", tt.name, from.Format(layout), to.Format(layout))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+			t.Errorf("%s: got %s to %s, want %s to %s", tt.name, from.Format(layout), to.Format(layout), tt.wantFrom.Format(layout), tt.wantTo.Format(layout))
+		}
+	}
+}
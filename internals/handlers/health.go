@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/render"
+)
+
+// * How long readiness waits for the database to answer a ping
+const readinessTimeout = 2 * time.Second
+
+type componentStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Latency string `json:"latency,omitempty"`
+}
+
+type readinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components"`
+}
+
+// Healthz: reports that the process is alive, it checks no dependency
+func (m *Repository) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Readyz: reports whether the database, template cache and mail worker are usable, with a 503 if any of them is not
+func (m *Repository) Readyz(w http.ResponseWriter, r *http.Request) {
+	resp := readinessResponse{
+		Status:     "ok",
+		Components: map[string]componentStatus{},
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := m.DB.Ping(ctx); err != nil {
+		resp.Components["database"] = componentStatus{Status: "down", Message: err.Error()}
+	} else {
+		resp.Components["database"] = componentStatus{Status: "ok", Latency: time.Since(start).String()}
+	}
+
+	if pages, err := render.CacheStatus(); err != nil {
+		resp.Components["templates"] = componentStatus{Status: "down", Message: err.Error()}
+	} else if pages == 0 {
+		resp.Components["templates"] = componentStatus{Status: "down", Message: "template cache is empty"}
+	} else {
+		resp.Components["templates"] = componentStatus{Status: "ok"}
+	}
+
+	if !m.App.MailWorkerRunning.Load() {
+		resp.Components["mail"] = componentStatus{Status: "down", Message: "mail worker is not running"}
+	} else {
+		resp.Components["mail"] = componentStatus{Status: "ok"}
+	}
+
+	status := http.StatusOK
+	for _, component := range resp.Components {
+		if component.Status != "ok" {
+			resp.Status = "down"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
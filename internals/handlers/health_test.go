@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/render"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// pingRepo: is a database whose ping fails with err
+type pingRepo struct {
+	repository.DatabaseRepo
+	err error
+}
+
+func (p pingRepo) Ping(ctx context.Context) error {
+	return p.err
+}
+
+// loadTemplates: builds the render cache from a temporary directory holding one page, or none
+func loadTemplates(t *testing.T, app *config.AppConfig, withPage bool) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if withPage {
+		if err := os.WriteFile(filepath.Join(dir, "home.page.tmpl"), []byte(`home`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.Templates = os.DirFS(dir)
+
+	if err := render.LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		pingErr    error
+		templates  bool
+		mail       bool
+		wantStatus int
+		wantDown   []string
+	}{
+		{name: "everything up", templates: true, mail: true, wantStatus: http.StatusOK},
+		{name: "database down", pingErr: errors.New("connection refused"), templates: true, mail: true, wantStatus: http.StatusServiceUnavailable, wantDown: []string{"database"}},
+		{name: "no templates", mail: true, wantStatus: http.StatusServiceUnavailable, wantDown: []string{"templates"}},
+		{name: "mail worker stopped", templates: true, wantStatus: http.StatusServiceUnavailable, wantDown: []string{"mail"}},
+	}
+
+	for _, tt := range tests {
+		app := &config.AppConfig{Logger: logging.New(io.Discard, false)}
+		render.NewRenderer(app)
+		loadTemplates(t, app, tt.templates)
+		app.MailWorkerRunning.Store(tt.mail)
+		m := &Repository{App: app, DB: pingRepo{err: tt.pingErr}}
+
+		rr := httptest.NewRecorder()
+		m.Readyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: status is %d, want %d", tt.name, rr.Code, tt.wantStatus)
+		}
+
+		var resp readinessResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: body is not json: %v", tt.name, err)
+		}
+
+		var down []string
+		for _, name := range []string{"database", "templates", "mail"} {
+			if resp.Components[name].Status != "ok" {
+				down = append(down, name)
+			}
+		}
+		if len(down) != len(tt.wantDown) || (len(down) > 0 && down[0] != tt.wantDown[0]) {
+			t.Errorf("%s: down components are %v, want %v", tt.name, down, tt.wantDown)
+		}
+		if (len(down) == 0) != (resp.Status == "ok") {
+			t.Errorf("%s: status is %q with %v down", tt.name, resp.Status, down)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// holder: returns the key the session holds rooms with, empty when it has never held one
+func (m *Repository) holder(r *http.Request) string {
+	return m.App.Session.GetString(r.Context(), "holder")
+}
+
+// holdRoom: holds the room of res for the session while the guest fills in the reservation form, false when another guest has it
+// * When holds are turned off every room counts as held
+func (m *Repository) holdRoom(r *http.Request, res models.Reservation) (bool, error) {
+	if m.App.HoldDuration <= 0 {
+		return true, nil
+	}
+
+	holder := m.holder(r)
+	if holder == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return false, err
+		}
+		holder = hex.EncodeToString(b)
+		m.App.Session.Put(r.Context(), "holder", holder)
+	}
+
+	expiresAt := time.Now().Add(m.App.HoldDuration)
+	_, err := m.DB.HoldRoom(r.Context(), models.RoomHold{
+		RoomID:    res.RoomId,
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+		Holder:    holder,
+		ExpiresAt: expiresAt,
+	})
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	m.App.Session.Put(r.Context(), "held_until", expiresAt.Unix())
+
+	return true, nil
+}
+
+// heldUntil: returns when the session's hold ends, zero when it has none or it has expired
+func (m *Repository) heldUntil(r *http.Request) time.Time {
+	until := m.App.Session.GetInt64(r.Context(), "held_until")
+	if until == 0 || time.Now().Unix() >= until {
+		return time.Time{}
+	}
+	return time.Unix(until, 0)
+}
+
+// ReleaseExpiredHolds: deletes expired holds every interval until ctx is cancelled
+func (m *Repository) ReleaseExpiredHolds(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		released, err := m.DB.DeleteExpiredHolds(ctx)
+		if err != nil {
+			m.App.Logger.Error("cannot release expired holds", "error", err)
+			continue
+		}
+
+		if released > 0 {
+			m.App.Logger.Info("released expired holds", "holds", released)
+		}
+	}
+}
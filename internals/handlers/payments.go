@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/payments"
+)
+
+// * Largest webhook body read from the provider
+const maxWebhookBytes = 64 << 10
+
+// deposit: returns what is authorized on the guest's card before a reservation costing total is confirmed, rounded up to the cent
+func (m *Repository) deposit(total int) int {
+	return (total*m.App.DepositPercent + 99) / 100
+}
+
+// paymentKey: returns the idempotency key of the session's payment attempt, so a repeated request doesn't hold the money twice
+func (m *Repository) paymentKey(r *http.Request) (string, error) {
+	key := m.App.Session.GetString(r.Context(), "payment_key")
+	if key != "" {
+		return key, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key = hex.EncodeToString(b)
+	m.App.Session.Put(r.Context(), "payment_key", key)
+
+	return key, nil
+}
+
+// authorizePayment: holds amount for res on the payment method, the reason is set instead when the card is declined
+// * Nothing is authorized for a zero amount, the authorization then has no ID
+func (m *Repository) authorizePayment(r *http.Request, res models.Reservation, amount int, paymentMethod string) (payments.Authorization, string, error) {
+	if amount == 0 {
+		return payments.Authorization{}, "", nil
+	}
+
+	key, err := m.paymentKey(r)
+	if err != nil {
+		return payments.Authorization{}, "", err
+	}
+
+	auth, err := m.Payments.Authorize(r.Context(), payments.AuthorizeRequest{
+		Amount:         amount,
+		Currency:       models.PaymentCurrency,
+		PaymentMethod:  paymentMethod,
+		Description:    res.Room.RoomName + " from " + res.StartDate.Format("2006-01-02") + " to " + res.EndDate.Format("2006-01-02"),
+		IdempotencyKey: key,
+	})
+	if errors.Is(err, payments.ErrDeclined) {
+		// * The provider remembers the answer to a key, another card needs a new one
+		m.App.Session.Remove(r.Context(), "payment_key")
+		m.logger(r).Info("payment declined", "error", err)
+		return auth, "Your card was declined, please use another one", nil
+	}
+	if err != nil {
+		return auth, "", err
+	}
+
+	return auth, "", nil
+}
+
+// authorizedPayment: returns the payment recording auth, which has no reference when nothing was authorized
+func (m *Repository) authorizedPayment(auth payments.Authorization) models.Payment {
+	return models.Payment{
+		Provider:  m.Payments.Name(),
+		Reference: auth.ID,
+		Status:    models.PaymentAuthorized,
+		Amount:    auth.Amount,
+		Currency:  models.PaymentCurrency,
+	}
+}
+
+// voidAuthorization: releases money held for a reservation which couldn't be made, a failure only leaves the hold until the provider drops it so it is logged
+// * The session's idempotency key is dropped too, the next attempt must hold the money again rather than get the released payment back
+func (m *Repository) voidAuthorization(r *http.Request, auth payments.Authorization) {
+	if auth.ID == "" {
+		return
+	}
+	m.App.Session.Remove(r.Context(), "payment_key")
+	if err := m.Payments.Void(context.WithoutCancel(r.Context()), auth.ID); err != nil {
+		m.logger(r).Error("cannot void payment", "provider", m.Payments.Name(), "reference", auth.ID, "error", err)
+	}
+}
+
+// settlePayments: takes the cancellation fee from the payments of a cancelled reservation and gives the rest back
+// * Held money is captured up to the fee and the rest released, captured money is refunded beyond the fee
+func (m *Repository) settlePayments(ctx context.Context, res models.Reservation, actor models.Actor) error {
+	list, err := m.DB.PaymentsByReservation(ctx, res.ID)
+	if err != nil {
+		return err
+	}
+
+	fee := res.CancellationFee
+	for _, p := range list {
+		if p.Provider != m.Payments.Name() {
+			return errors.New("payment " + p.Reference + " was made with " + p.Provider + ", settle it there")
+		}
+
+		switch p.Status {
+		case models.PaymentAuthorized:
+			keep := min(fee, p.Amount)
+			if keep > 0 {
+				err = m.Payments.Capture(ctx, p.Reference, keep)
+				p.Status = models.PaymentCaptured
+				p.CapturedAmount = keep
+			} else {
+				err = m.Payments.Void(ctx, p.Reference)
+				p.Status = models.PaymentVoided
+			}
+			fee -= keep
+		case models.PaymentCaptured:
+			keep := min(fee, p.Refundable())
+			refund := p.Refundable() - keep
+			if refund > 0 {
+				err = m.Payments.Refund(ctx, p.Reference, refund)
+				p.RefundedAmount += refund
+				if p.Refundable() == 0 {
+					p.Status = models.PaymentRefunded
+				}
+			}
+			fee -= keep
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = m.DB.UpdatePayment(ctx, p, actor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PostAdminCapturePayment: captures the whole amount held by a payment of the reservation, e.g. at check-in
+func (m *Repository) PostAdminCapturePayment(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := m.adminReservation(w, r)
+	if !ok {
+		return
+	}
+	back := "/admin/reservations/" + strconv.Itoa(reservation.ID)
+
+	paymentId, err := strconv.Atoi(chi.URLParam(r, "paymentId"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	list, err := m.DB.PaymentsByReservation(r.Context(), reservation.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	var payment models.Payment
+	for _, p := range list {
+		if p.ID == paymentId {
+			payment = p
+		}
+	}
+	if payment.ID == 0 {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	if payment.Status != models.PaymentAuthorized || payment.Provider != m.Payments.Name() {
+		m.App.Session.Put(r.Context(), "error", "This payment can't be captured")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = m.Payments.Capture(r.Context(), payment.Reference, payment.Amount)
+	if errors.Is(err, payments.ErrRefused) || errors.Is(err, payments.ErrUnknownPayment) {
+		m.App.Session.Put(r.Context(), "error", "The payment provider refused the capture: "+err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	payment.Status = models.PaymentCaptured
+	payment.CapturedAmount = payment.Amount
+	if err := m.DB.UpdatePayment(r.Context(), payment, helpers.Actor(r)); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Payment captured")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PaymentWebhook: updates a payment from a signed webhook of the provider, for changes made outside the app such as a refund from its dashboard
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	event, err := m.Payments.VerifyWebhook(payload, r.Header.Get("Stripe-Signature"))
+	if err != nil {
+		m.logger(r).Warn("rejected payment webhook", "error", err)
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// * Events are told apart by their ID, one without it can't be recorded
+	if event.ID == "" {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// * Payments the app didn't make and events it doesn't act on are acknowledged, so the provider stops sending them
+	payment, err := m.DB.PaymentByReference(r.Context(), m.Payments.Name(), event.PaymentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	change := models.PaymentEvent{ID: event.ID, Provider: m.Payments.Name(), Amount: event.Amount}
+	switch event.Type {
+	case payments.EventCaptured:
+		change.Status = models.PaymentCaptured
+	case payments.EventCanceled:
+		change.Status = models.PaymentVoided
+	case payments.EventFailed:
+		change.Status = models.PaymentFailed
+	case payments.EventRefunded:
+		change.Status = models.PaymentRefunded
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// * The provider may send an event again or after a later one, those are acknowledged without changing the payment
+	applied, err := m.DB.ApplyPaymentEvent(r.Context(), payment.ID, change, models.Actor{Email: m.Payments.Name() + " webhook"})
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !applied {
+		m.logger(r).Info("ignored payment webhook", "event", event.ID, "type", event.Type, "reference", payment.Reference, "status", payment.Status)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/payments"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// paymentsRepo: is a DatabaseRepo holding the payments of one reservation, any other method panics
+type paymentsRepo struct {
+	repository.DatabaseRepo
+	payments []models.Payment
+	updated  []models.Payment
+}
+
+func (r *paymentsRepo) PaymentsByReservation(ctx context.Context, reservationId int) ([]models.Payment, error) {
+	return r.payments, nil
+}
+
+func (r *paymentsRepo) UpdatePayment(ctx context.Context, payment models.Payment, actor models.Actor) error {
+	r.updated = append(r.updated, payment)
+	return nil
+}
+
+// fakePayment: authorizes amount with the fake and captures captured of it when it isn't 0
+func fakePayment(t *testing.T, fake *payments.Fake, amount, captured int) models.Payment {
+	t.Helper()
+
+	auth, err := fake.Authorize(context.Background(), payments.AuthorizeRequest{Amount: amount, PaymentMethod: "pm_card_visa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := models.Payment{Provider: fake.Name(), Reference: auth.ID, Status: models.PaymentAuthorized, Amount: amount}
+	if captured > 0 {
+		if err := fake.Capture(context.Background(), auth.ID, captured); err != nil {
+			t.Fatal(err)
+		}
+		p.Status = models.PaymentCaptured
+		p.CapturedAmount = captured
+	}
+
+	return p
+}
+
+func TestSettlePayments(t *testing.T) {
+	type held struct{ amount, captured int }
+	type want struct {
+		status   string
+		captured int
+		refunded int
+	}
+
+	tests := []struct {
+		name     string
+		payments []held
+		fee      int
+		want     []want
+	}{
+		{"free cancellation releases the hold", []held{{10000, 0}}, 0, []want{{models.PaymentVoided, 0, 0}}},
+		{"fee is captured from the hold", []held{{10000, 0}}, 3000, []want{{models.PaymentCaptured, 3000, 0}}},
+		{"fee above the hold takes all of it", []held{{10000, 0}}, 15000, []want{{models.PaymentCaptured, 10000, 0}}},
+		{"captured money beyond the fee is refunded", []held{{10000, 10000}}, 3000, []want{{models.PaymentCaptured, 10000, 7000}}},
+		{"free cancellation refunds everything", []held{{10000, 10000}}, 0, []want{{models.PaymentRefunded, 10000, 10000}}},
+		{
+			"fee is taken from the payments in order",
+			[]held{{5000, 0}, {5000, 0}},
+			7000,
+			[]want{{models.PaymentCaptured, 5000, 0}, {models.PaymentCaptured, 2000, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		fake := payments.NewFake("whsec_test")
+		db := &paymentsRepo{}
+		for _, h := range tt.payments {
+			db.payments = append(db.payments, fakePayment(t, fake, h.amount, h.captured))
+		}
+		m := &Repository{App: &config.AppConfig{}, DB: db, Payments: fake}
+
+		err := m.settlePayments(context.Background(), models.Reservation{ID: 1, CancellationFee: tt.fee}, models.Actor{Email: "test"})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if len(db.updated) != len(tt.want) {
+			t.Errorf("%s: %d payments updated, want %d", tt.name, len(db.updated), len(tt.want))
+			continue
+		}
+
+		for i, w := range tt.want {
+			p := db.updated[i]
+			if p.Status != w.status || p.CapturedAmount != w.captured || p.RefundedAmount != w.refunded {
+				t.Errorf("%s: payment %d is %s captured %d refunded %d, want %s captured %d refunded %d",
+					tt.name, i, p.Status, p.CapturedAmount, p.RefundedAmount, w.status, w.captured, w.refunded)
+			}
+
+			// * The provider must agree with what is saved
+			f, _ := fake.Payment(p.Reference)
+			if f.Captured != p.CapturedAmount || f.Refunded != p.RefundedAmount {
+				t.Errorf("%s: provider has payment %d captured %d refunded %d", tt.name, i, f.Captured, f.Refunded)
+			}
+		}
+	}
+}
+
+func TestSettlePaymentsSkipsSettledPayments(t *testing.T) {
+	fake := payments.NewFake("whsec_test")
+	db := &paymentsRepo{payments: []models.Payment{
+		{Provider: fake.Name(), Reference: "pi_voided", Status: models.PaymentVoided, Amount: 10000},
+		{Provider: fake.Name(), Reference: "pi_refunded", Status: models.PaymentRefunded, Amount: 10000, CapturedAmount: 10000, RefundedAmount: 10000},
+	}}
+	m := &Repository{App: &config.AppConfig{}, DB: db, Payments: fake}
+
+	if err := m.settlePayments(context.Background(), models.Reservation{ID: 1}, models.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.updated) != 0 {
+		t.Errorf("settled payments were updated: %+v", db.updated)
+	}
+}
+
+func TestSettlePaymentsOfAnotherProvider(t *testing.T) {
+	db := &paymentsRepo{payments: []models.Payment{
+		{Provider: "stripe", Reference: "pi_1", Status: models.PaymentAuthorized, Amount: 10000},
+	}}
+	m := &Repository{App: &config.AppConfig{}, DB: db, Payments: payments.NewFake("whsec_test")}
+
+	if err := m.settlePayments(context.Background(), models.Reservation{ID: 1}, models.Actor{}); err == nil {
+		t.Error("expected an error settling a payment made with another provider")
+	}
+	if len(db.updated) != 0 {
+		t.Errorf("payments were updated: %+v", db.updated)
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/render"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// * Longest free cancellation period accepted by the policy form
+const maxFreeCancellationDays = 365
+
+// AdminCancellationPolicies: lists the cancellation policies with the form to add one
+func (m *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := m.DB.CancellationPolicies(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := render.Template(w, r, "admin-cancellation-policies.page.tmpl", &models.TemplateData{
+		View: models.AdminCancellationPoliciesView{Policies: policies},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// PostAdminCancellationPolicy: adds a cancellation policy
+func (m *Repository) PostAdminCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	back := "/admin/cancellation-policies"
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	policy, problems := policyFromForm(r)
+	if len(problems) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Cancellation policy not added: "+strings.Join(problems, ", "))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if _, err := m.DB.InsertCancellationPolicy(r.Context(), policy, helpers.Actor(r)); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy added")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostAdminDeleteCancellationPolicy: removes a cancellation policy which no rate plan uses
+func (m *Repository) PostAdminDeleteCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	back := "/admin/cancellation-policies"
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	err = m.DB.DeleteCancellationPolicy(r.Context(), id, helpers.Actor(r))
+	if errors.Is(err, repository.ErrPolicyInUse) {
+		m.App.Session.Put(r.Context(), "error", "This policy is used by rate plans, remove them first")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy deleted")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostAdminRatePlan: adds a rate plan to the room
+func (m *Repository) PostAdminRatePlan(w http.ResponseWriter, r *http.Request) {
+	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	back := "/admin/rooms/" + strconv.Itoa(roomId)
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := m.DB.GetRoomById(r.Context(), roomId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientError(w, r, http.StatusNotFound)
+			return
+		}
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	policies, err := m.DB.CancellationPolicies(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	plan, problems := ratePlanFromAdminForm(r, policies)
+	if len(problems) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Rate plan not added: "+strings.Join(problems, ", "))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	plan.RoomID = roomId
+
+	if _, err := m.DB.InsertRatePlan(r.Context(), plan, helpers.Actor(r)); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rate plan added")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostAdminDeleteRatePlan: removes a rate plan from the room, reservations made with it keep their copy
+func (m *Repository) PostAdminDeleteRatePlan(w http.ResponseWriter, r *http.Request) {
+	roomId, err1 := strconv.Atoi(chi.URLParam(r, "id"))
+	planId, err2 := strconv.Atoi(chi.URLParam(r, "planId"))
+	if err1 != nil || err2 != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	err := m.DB.DeleteRatePlan(r.Context(), roomId, planId, helpers.Actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rate plan deleted")
+	http.Redirect(w, r, "/admin/rooms/"+strconv.Itoa(roomId), http.StatusSeeOther)
+}
+
+// policyFromForm: reads the cancellation policy form, the problems are listed for the flash message
+func policyFromForm(r *http.Request) (models.CancellationPolicy, []string) {
+	var policy models.CancellationPolicy
+	var problems []string
+
+	policy.Name = strings.TrimSpace(r.Form.Get("name"))
+	if policy.Name == "" || len(policy.Name) > 100 {
+		problems = append(problems, "enter a name of up to 100 characters")
+	}
+
+	days, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("free_cancellation_days")))
+	if err != nil || days < 0 || days > maxFreeCancellationDays {
+		problems = append(problems, "free cancellation days should be from 0 to "+strconv.Itoa(maxFreeCancellationDays))
+	}
+	policy.FreeCancellationDays = days
+
+	percent, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("late_penalty_percent")))
+	if err != nil || percent < 0 || percent > 100 {
+		problems = append(problems, "the penalty should be from 0 to 100%")
+	}
+	policy.LatePenaltyPercent = percent
+
+	return policy, problems
+}
+
+// ratePlanFromAdminForm: reads the rate plan form of the admin room page, the policy must be one of policies
+func ratePlanFromAdminForm(r *http.Request, policies []models.CancellationPolicy) (models.RatePlan, []string) {
+	var plan models.RatePlan
+	var problems []string
+
+	plan.Name = strings.TrimSpace(r.Form.Get("name"))
+	if plan.Name == "" || len(plan.Name) > 100 {
+		problems = append(problems, "enter a name of up to 100 characters")
+	}
+
+	discount, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("discount_percent")))
+	if err != nil || discount < 0 || discount > 99 {
+		problems = append(problems, "the discount should be from 0 to 99%")
+	}
+	plan.DiscountPercent = discount
+
+	policyId, _ := strconv.Atoi(r.Form.Get("cancellation_policy_id"))
+	for _, policy := range policies {
+		if policy.ID == policyId {
+			plan.CancellationPolicyID = policy.ID
+			plan.Policy = policy
+		}
+	}
+	if plan.CancellationPolicyID == 0 {
+		problems = append(problems, "choose a cancellation policy")
+	}
+
+	return plan, problems
+}
@@ -0,0 +1,569 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imrcht/bed-n-breakfast/internals/forms"
+	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/images"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/render"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+const (
+	// * Largest capacity accepted by the room form
+	maxRoomCapacity = 50
+
+	// * Limits of a photo upload, a single file and the whole request
+	maxPhotoBytes  = 10 << 20
+	maxUploadBytes = 50 << 20
+)
+
+// Rooms: lists the active rooms
+func (m *Repository) Rooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context(), true)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := render.Template(w, r, "rooms.page.tmpl", &models.TemplateData{
+		View: models.RoomsView{Rooms: rooms},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// Room: renders the page of the room with the slug in the url, inactive rooms are not found
+func (m *Repository) Room(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// * Only the rules which can still apply are shown
+	room, err = m.withStayRules(r, room, today())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := render.Template(w, r, "room.page.tmpl", &models.TemplateData{
+		View: models.RoomView{Room: room},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// AdminRooms: lists every room, active or not
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context(), false)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if err := render.Template(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		View: models.AdminRoomsView{Rooms: rooms},
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// AdminRoom: shows the room form, empty when the id is "new"
+func (m *Repository) AdminRoom(w http.ResponseWriter, r *http.Request) {
+	room := models.Room{Capacity: 2, IncludedGuests: 2, Active: true}
+
+	if idParam := chi.URLParam(r, "id"); idParam != "new" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusNotFound)
+			return
+		}
+
+		room, err = m.DB.GetRoomById(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientError(w, r, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		room, err = m.withStayRules(r, room, today())
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	m.renderAdminRoom(w, r, room, forms.New(nil))
+}
+
+// PostAdminRoom: creates the room when the id is "new", otherwise updates it
+func (m *Repository) PostAdminRoom(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	room, form := roomFromForm(r)
+
+	idParam := chi.URLParam(r, "id")
+	if idParam != "new" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusNotFound)
+			return
+		}
+		room.ID = id
+	}
+
+	if !form.Valid() {
+		m.renderAdminRoom(w, r, room, form)
+		return
+	}
+
+	var err error
+	if room.ID == 0 {
+		room.ID, err = m.DB.InsertRoom(r.Context(), room, helpers.Actor(r))
+	} else {
+		err = m.DB.UpdateRoom(r.Context(), room, helpers.Actor(r))
+	}
+
+	if errors.Is(err, repository.ErrDuplicateSlug) {
+		form.Errors.Add("slug", err.Error())
+		m.renderAdminRoom(w, r, room, form)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// PostAdminDeleteRoom: deletes a room which has never been reserved
+func (m *Repository) PostAdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	room, err := m.DB.GetRoomById(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	err = m.DB.DeleteRoom(r.Context(), id, helpers.Actor(r))
+	if errors.Is(err, repository.ErrRoomHasReservations) {
+		m.App.Session.Put(r.Context(), "error", "This room has reservations, deactivate it instead")
+		http.Redirect(w, r, "/admin/rooms/"+strconv.Itoa(id), http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// * The photo rows went with the room, their files are removed afterwards
+	for _, photo := range room.Photos {
+		m.removePhotoFiles(r, photo)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// PostAdminRoomPhotos: adds the uploaded photos to the end of the room gallery, each is checked, resized and stored as jpeg
+func (m *Repository) PostAdminRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	back := "/admin/rooms/" + strconv.Itoa(roomId)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(maxPhotoBytes); err != nil {
+		m.App.Session.Put(r.Context(), "error", "Upload is too large, send fewer photos at once")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if _, err := m.DB.GetRoomById(r.Context(), roomId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientError(w, r, http.StatusNotFound)
+			return
+		}
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	store := m.photoStore()
+	var rejected []string
+	added := 0
+
+	for _, header := range r.MultipartForm.File["photos"] {
+		if header.Size > maxPhotoBytes {
+			rejected = append(rejected, header.Filename+" is larger than 10MB")
+			continue
+		}
+
+		data, err := readUpload(header)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		variants, err := images.Process(data)
+		if errors.Is(err, images.ErrUnsupported) || errors.Is(err, images.ErrTooLarge) {
+			rejected = append(rejected, header.Filename+": "+err.Error())
+			continue
+		}
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		urls, err := store.Save(roomId, variants)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		photo := models.RoomPhoto{
+			RoomID:    roomId,
+			URL:       urls["large"],
+			MediumURL: urls["medium"],
+			ThumbURL:  urls["thumb"],
+		}
+
+		if _, err = m.DB.InsertRoomPhoto(r.Context(), photo, helpers.Actor(r)); err != nil {
+			store.Remove(urls["large"], urls["medium"], urls["thumb"])
+			helpers.ServerError(w, r, err)
+			return
+		}
+		added++
+	}
+
+	if len(rejected) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Not added: "+strings.Join(rejected, ", "))
+	}
+	if added > 0 {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Added %d %s", added, render.Pluralize(added, "photo", "photos")))
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostAdminMoveRoomPhoto: moves a photo one place up or down in the room gallery
+func (m *Repository) PostAdminMoveRoomPhoto(w http.ResponseWriter, r *http.Request) {
+	roomId, err1 := strconv.Atoi(chi.URLParam(r, "id"))
+	photoId, err2 := strconv.Atoi(chi.URLParam(r, "photoId"))
+	if err1 != nil || err2 != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	offset := 1
+	if r.Form.Get("direction") == "up" {
+		offset = -1
+	}
+
+	err := m.DB.MoveRoomPhoto(r.Context(), roomId, photoId, offset, helpers.Actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/rooms/"+strconv.Itoa(roomId), http.StatusSeeOther)
+}
+
+// PostAdminDeleteRoomPhoto: removes a photo from the room gallery and deletes its files
+func (m *Repository) PostAdminDeleteRoomPhoto(w http.ResponseWriter, r *http.Request) {
+	roomId, err1 := strconv.Atoi(chi.URLParam(r, "id"))
+	photoId, err2 := strconv.Atoi(chi.URLParam(r, "photoId"))
+	if err1 != nil || err2 != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	photo, err := m.DB.DeleteRoomPhoto(r.Context(), roomId, photoId, helpers.Actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.removePhotoFiles(r, photo)
+
+	m.App.Session.Put(r.Context(), "flash", "Photo deleted")
+	http.Redirect(w, r, "/admin/rooms/"+strconv.Itoa(roomId), http.StatusSeeOther)
+}
+
+// PostAdminStayRule: adds a stay rule to the room
+func (m *Repository) PostAdminStayRule(w http.ResponseWriter, r *http.Request) {
+	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	back := "/admin/rooms/" + strconv.Itoa(roomId)
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	rule, problems := stayRuleFromForm(r)
+	if len(problems) > 0 {
+		m.App.Session.Put(r.Context(), "error", "Stay rule not added: "+strings.Join(problems, ", "))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	rule.RoomID = roomId
+
+	if _, err := m.DB.GetRoomById(r.Context(), roomId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientError(w, r, http.StatusNotFound)
+			return
+		}
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if _, err := m.DB.InsertStayRule(r.Context(), rule, helpers.Actor(r)); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule added")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostAdminDeleteStayRule: removes a stay rule from the room
+func (m *Repository) PostAdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	roomId, err1 := strconv.Atoi(chi.URLParam(r, "id"))
+	ruleId, err2 := strconv.Atoi(chi.URLParam(r, "ruleId"))
+	if err1 != nil || err2 != nil {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	err := m.DB.DeleteStayRule(r.Context(), roomId, ruleId, helpers.Actor(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule deleted")
+	http.Redirect(w, r, "/admin/rooms/"+strconv.Itoa(roomId), http.StatusSeeOther)
+}
+
+// stayRuleFromForm: reads the stay rule form, the problems are listed for the flash message
+func stayRuleFromForm(r *http.Request) (models.StayRule, []string) {
+	var rule models.StayRule
+	var problems []string
+
+	layout := "2006-01-02"
+	start, err1 := time.Parse(layout, r.Form.Get("start_date"))
+	end, err2 := time.Parse(layout, r.Form.Get("end_date"))
+	if err1 != nil || err2 != nil {
+		problems = append(problems, "choose a start and end date")
+	} else if end.Before(start) {
+		problems = append(problems, "the end date is before the start date")
+	}
+
+	minNights, err1 := strconv.Atoi(strings.TrimSpace(r.Form.Get("min_nights")))
+	maxNights, err2 := strconv.Atoi(strings.TrimSpace(r.Form.Get("max_nights")))
+	if err1 != nil || minNights < 1 || minNights > maxStayNights {
+		problems = append(problems, fmt.Sprintf("minimum nights should be from 1 to %d", maxStayNights))
+	}
+	if err2 != nil || maxNights < 0 || maxNights > maxStayNights {
+		problems = append(problems, fmt.Sprintf("maximum nights should be from 0 to %d", maxStayNights))
+	} else if maxNights > 0 && maxNights < minNights {
+		problems = append(problems, "maximum nights is less than the minimum")
+	}
+
+	rule.StartDate = start
+	rule.EndDate = end
+	rule.MinNights = minNights
+	rule.MaxNights = maxNights
+	rule.ClosedToArrival = weekdaysFromForm(r.Form["closed_to_arrival"])
+	rule.ClosedToDeparture = weekdaysFromForm(r.Form["closed_to_departure"])
+
+	return rule, problems
+}
+
+// weekdaysFromForm: turns checkbox values 0 (Sunday) to 6 (Saturday) into a set, other values are ignored
+func weekdaysFromForm(values []string) models.Weekdays {
+	var days models.Weekdays
+	for _, v := range values {
+		if day, err := strconv.Atoi(v); err == nil && day >= 0 && day <= 6 {
+			days = days.With(time.Weekday(day))
+		}
+	}
+	return days
+}
+
+// today: returns the current date at midnight utc, the way dates are parsed from forms
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (m *Repository) photoStore() images.Store {
+	return images.Store{Dir: m.App.UploadsDir, URLPrefix: "/uploads"}
+}
+
+// removePhotoFiles: deletes the uploaded files of a photo, a failure only leaves an unused file so it is logged
+func (m *Repository) removePhotoFiles(r *http.Request, photo models.RoomPhoto) {
+	if err := m.photoStore().Remove(photo.URL, photo.MediumURL, photo.ThumbURL); err != nil {
+		m.logger(r).Warn("cannot remove photo files", "photo_id", photo.ID, "error", err)
+	}
+}
+
+func readUpload(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, maxPhotoBytes))
+}
+
+func (m *Repository) renderAdminRoom(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	view := models.AdminRoomView{Room: room}
+
+	// * A room being added has no rate plans yet
+	if room.ID > 0 {
+		var err error
+		if view.RatePlans, err = m.DB.RatePlans(r.Context(), room.ID); err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		if view.Policies, err = m.DB.CancellationPolicies(r.Context()); err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := render.Template(w, r, "admin-room.page.tmpl", &models.TemplateData{
+		Form: form,
+		View: view,
+	}); err != nil {
+		helpers.ServerError(w, r, err)
+	}
+}
+
+// roomFromForm: reads and validates the room form, the slug is made from the name when left empty
+func roomFromForm(r *http.Request) (models.Room, *forms.Form) {
+	form := forms.New(r.PostForm)
+	if strings.TrimSpace(form.Get("slug")) == "" {
+		form.Set("slug", slugify(form.Get("room_name")))
+	}
+
+	form.Required("room_name", "slug")
+	form.IsSlug("slug")
+	form.IsIntBetween("capacity", 1, maxRoomCapacity)
+	form.IsIntBetween("included_guests", 1, maxRoomCapacity)
+	form.IsMoney("nightly_rate")
+	form.IsMoney("extra_adult_fee")
+	form.IsMoney("extra_child_fee")
+
+	capacity, _ := strconv.Atoi(strings.TrimSpace(form.Get("capacity")))
+	includedGuests, _ := strconv.Atoi(strings.TrimSpace(form.Get("included_guests")))
+	nightlyRate, _ := forms.Cents(form.Get("nightly_rate"))
+	extraAdultFee, _ := forms.Cents(form.Get("extra_adult_fee"))
+	extraChildFee, _ := forms.Cents(form.Get("extra_child_fee"))
+
+	if form.Errors.Get("included_guests") == "" && includedGuests > capacity {
+		form.Errors.Add("included_guests", "This can't be more than the capacity")
+	}
+
+	room := models.Room{
+		RoomName:    strings.TrimSpace(form.Get("room_name")),
+		Slug:        form.Get("slug"),
+		Description: strings.TrimSpace(form.Get("description")),
+		Capacity:    capacity,
+		Amenities:   lines(form.Get("amenities")),
+		Active:      form.Get("active") != "",
+
+		NightlyRate:    nightlyRate,
+		IncludedGuests: includedGuests,
+		ExtraAdultFee:  extraAdultFee,
+		ExtraChildFee:  extraChildFee,
+	}
+
+	return room, form
+}
+
+// lines: splits a textarea into its non empty trimmed lines
+func lines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify: turns "General's Quarters" into "general-s-quarters"
+func slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
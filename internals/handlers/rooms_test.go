@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// roomsRepo: is a database holding rooms by slug
+type roomsRepo struct {
+	repository.DatabaseRepo
+	rooms map[string]models.Room
+	err   error
+}
+
+func (r roomsRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	if r.err != nil {
+		return models.Room{}, r.err
+	}
+	room, ok := r.rooms[slug]
+	if !ok {
+		return models.Room{}, sql.ErrNoRows
+	}
+	return room, nil
+}
+
+func TestRoomNotFound(t *testing.T) {
+	app := &config.AppConfig{Logger: logging.New(io.Discard, false)}
+	helpers.NewHelpers(app)
+
+	db := roomsRepo{rooms: map[string]models.Room{
+		"closed-suite": {ID: 3, RoomName: "Closed Suite", Slug: "closed-suite", Active: false},
+	}}
+
+	tests := []struct {
+		name       string
+		slug       string
+		err        error
+		wantStatus int
+	}{
+		{name: "inactive room", slug: "closed-suite", wantStatus: http.StatusNotFound},
+		{name: "unknown slug", slug: "no-such-room", wantStatus: http.StatusNotFound},
+		{name: "database error", slug: "closed-suite", err: errors.New("connection reset"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		db.err = tt.err
+		m := &Repository{App: app, DB: db}
+
+		req := httptest.NewRequest(http.MethodGet, "/rooms/"+tt.slug, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("slug", tt.slug)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		m.Room(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: status is %d, want %d", tt.name, rr.Code, tt.wantStatus)
+		}
+	}
+}
+
+// roomForm: returns a valid room form with the given fields replaced
+func roomForm(fields url.Values) url.Values {
+	form := url.Values{
+		"room_name":       {"Suite"},
+		"capacity":        {"4"},
+		"included_guests": {"2"},
+		"nightly_rate":    {"95.50"},
+		"extra_adult_fee": {"20"},
+		"extra_child_fee": {"10"},
+	}
+	for key, value := range fields {
+		form[key] = value
+	}
+	return form
+}
+
+func TestRoomFromForm(t *testing.T) {
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantSlug string
+		wantRate int
+		wantErr  string
+	}{
+		{name: "slug made from the name", form: roomForm(url.Values{"room_name": {"General's Quarters"}}), wantSlug: "general-s-quarters", wantRate: 9550},
+		{name: "slug kept when given", form: roomForm(url.Values{"slug": {"blue-suite"}}), wantSlug: "blue-suite", wantRate: 9550},
+		{name: "invalid slug", form: roomForm(url.Values{"slug": {"Blue Suite"}}), wantErr: "slug"},
+		{name: "capacity too large", form: roomForm(url.Values{"capacity": {"51"}}), wantErr: "capacity"},
+		{name: "more included guests than capacity", form: roomForm(url.Values{"included_guests": {"5"}}), wantErr: "included_guests"},
+		{name: "rate is not an amount", form: roomForm(url.Values{"nightly_rate": {"95.5.0"}}), wantErr: "nightly_rate"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/admin/rooms/new", strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+
+		room, form := roomFromForm(req)
+
+		if tt.wantErr != "" {
+			if form.Errors.Get(tt.wantErr) == "" {
+				t.Errorf("%s: no error on %s", tt.name, tt.wantErr)
+			}
+			continue
+		}
+		if !form.Valid() {
+			t.Errorf("%s: form is invalid: %v", tt.name, form.Errors)
+		}
+		if room.Slug != tt.wantSlug {
+			t.Errorf("%s: slug is %q, want %q", tt.name, room.Slug, tt.wantSlug)
+		}
+		if room.NightlyRate != tt.wantRate {
+			t.Errorf("%s: nightly rate is %d, want %d", tt.name, room.NightlyRate, tt.wantRate)
+		}
+	}
+}
+
+func TestToday(t *testing.T) {
+	before := time.Now()
+	got := today()
+	after := time.Now()
+
+	if got.Location() != time.UTC || got.Hour() != 0 || got.Minute() != 0 || got.Second() != 0 || got.Nanosecond() != 0 {
+		t.Errorf("today() = %v, want midnight utc", got)
+	}
+
+	// * The date is the local one, as typed by the guest, even when utc is already on another day
+	if y, m, d := before.Date(); got != time.Date(y, m, d, 0, 0, 0, 0, time.UTC) {
+		if y, m, d := after.Date(); got != time.Date(y, m, d, 0, 0, 0, 0, time.UTC) {
+			t.Errorf("today() = %v, want the date of %v", got, before)
+		}
+	}
+}
+
+func TestWeekdaysFromForm(t *testing.T) {
+	got := weekdaysFromForm([]string{"0", "6", "7", "-1", "x", "6"})
+	if want := models.Weekdays(0).With(time.Sunday).With(time.Saturday); got != want {
+		t.Errorf("weekdaysFromForm = %v, want %v", got, want)
+	}
+}
@@ -1,11 +1,12 @@
 package helpers
 
 import (
-	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
 )
 
@@ -16,14 +17,13 @@ func NewHelpers(a *config.AppConfig) {
 	app = a
 }
 
-func ClientError(w http.ResponseWriter, status int) {
-	app.ErrorLog.Println("Client error with status of", http.StatusText(status))
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	logging.FromContext(r.Context(), app.Logger).Warn("client error", "status", status, "status_text", http.StatusText(status))
 	http.Error(w, http.StatusText(status), status)
 }
 
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context(), app.Logger).Error("server error", "error", err, "stack", string(debug.Stack()))
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
@@ -39,3 +39,20 @@ func UserAccessLevel(r *http.Request) int {
 	user := app.Session.Get(r.Context(), "user").(models.User)
 	return user.AccessLevel
 }
+
+// Actor: returns who is making the request, for the audit log
+func Actor(r *http.Request) models.Actor {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	actor := models.Actor{IP: ip}
+
+	if user, ok := app.Session.Get(r.Context(), "user").(models.User); ok {
+		actor.UserID = user.ID
+		actor.Email = user.Email
+	}
+
+	return actor
+}
@@ -0,0 +1,203 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// redBlue: returns a 2x1 image, red on the left and blue on the right
+func redBlue() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+	return img
+}
+
+// withExifOrientation: inserts an APP1 Exif segment holding orientation right after the jpeg start marker
+func withExifOrientation(t *testing.T, jpg []byte, order binary.ByteOrder, orientation uint16) []byte {
+	t.Helper()
+
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, header...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJpegOrientation(t *testing.T) {
+	plain := encodeJPEG(t, redBlue())
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{name: "no exif", data: plain, want: 1},
+		{name: "little endian", data: withExifOrientation(t, plain, binary.LittleEndian, 6), want: 6},
+		{name: "big endian", data: withExifOrientation(t, plain, binary.BigEndian, 8), want: 8},
+		{name: "not a jpeg", data: []byte("GIF89a...."), want: 1},
+		{name: "truncated segment", data: withExifOrientation(t, plain, binary.BigEndian, 3)[:12], want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: orientation is %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	tests := []struct {
+		orientation int
+		wantW       int
+		wantH       int
+		wantFirst   color.RGBA
+	}{
+		{orientation: 1, wantW: 2, wantH: 1, wantFirst: red},
+		{orientation: 2, wantW: 2, wantH: 1, wantFirst: blue},
+		{orientation: 3, wantW: 2, wantH: 1, wantFirst: blue},
+		{orientation: 4, wantW: 2, wantH: 1, wantFirst: red},
+		{orientation: 5, wantW: 1, wantH: 2, wantFirst: red},
+		{orientation: 6, wantW: 1, wantH: 2, wantFirst: red},
+		{orientation: 7, wantW: 1, wantH: 2, wantFirst: blue},
+		{orientation: 8, wantW: 1, wantH: 2, wantFirst: blue},
+		{orientation: 9, wantW: 2, wantH: 1, wantFirst: red},
+	}
+
+	for _, tt := range tests {
+		got := orient(redBlue(), tt.orientation)
+
+		if got.Bounds().Dx() != tt.wantW || got.Bounds().Dy() != tt.wantH {
+			t.Errorf("orientation %d: size is %v, want %dx%d", tt.orientation, got.Bounds().Size(), tt.wantW, tt.wantH)
+			continue
+		}
+		if first := got.RGBAAt(0, 0); first != tt.wantFirst {
+			t.Errorf("orientation %d: first pixel is %v, want %v", tt.orientation, first, tt.wantFirst)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name    string
+		w, h    int
+		maxEdge int
+		wantW   int
+		wantH   int
+	}{
+		{name: "landscape", w: 400, h: 200, maxEdge: 200, wantW: 200, wantH: 100},
+		{name: "portrait", w: 300, h: 900, maxEdge: 300, wantW: 100, wantH: 300},
+		{name: "never enlarged", w: 50, h: 40, maxEdge: 200, wantW: 50, wantH: 40},
+		{name: "thin strip keeps one pixel", w: 1000, h: 1, maxEdge: 10, wantW: 10, wantH: 1},
+	}
+
+	for _, tt := range tests {
+		got := Resize(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.maxEdge)
+		if got.Bounds().Dx() != tt.wantW || got.Bounds().Dy() != tt.wantH {
+			t.Errorf("%s: size is %v, want %dx%d", tt.name, got.Bounds().Size(), tt.wantW, tt.wantH)
+		}
+	}
+
+	// * Each new pixel is the average of the pixels it covers
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{A: 255})
+	src.Set(1, 0, color.RGBA{R: 200, G: 200, B: 200, A: 255})
+	if got := Resize(src, 1).RGBAAt(0, 0); got != (color.RGBA{R: 100, G: 100, B: 100, A: 255}) {
+		t.Errorf("averaged pixel is %v, want 100 grey", got)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewNRGBA(image.Rect(0, 0, 1000, 500))); err != nil {
+		t.Fatal(err)
+	}
+
+	// * A gif only declares its size in the header, so one claiming 10000x10000 pixels is cheap to make
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	huge := gifData.Bytes()
+	binary.LittleEndian.PutUint16(huge[6:], 10000)
+	binary.LittleEndian.PutUint16(huge[8:], 10000)
+
+	sideways := withExifOrientation(t, encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 300, 100))), binary.BigEndian, 6)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantErr   error
+		wantLarge image.Point
+	}{
+		{name: "png", data: pngData.Bytes(), wantLarge: image.Pt(1000, 500)},
+		{name: "rotated jpeg", data: sideways, wantLarge: image.Pt(100, 300)},
+		{name: "not an image", data: []byte("<html><body>hello</body></html>"), wantErr: ErrUnsupported},
+		{name: "too many pixels", data: huge, wantErr: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		variants, err := Process(tt.data)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error is %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		for _, size := range Sizes {
+			img, format, err := image.Decode(bytes.NewReader(variants[size.Name]))
+			if err != nil || format != "jpeg" {
+				t.Errorf("%s: %s is not a jpeg: %v", tt.name, size.Name, err)
+				continue
+			}
+			b := img.Bounds()
+			if b.Dx() > size.MaxEdge || b.Dy() > size.MaxEdge {
+				t.Errorf("%s: %s is %v, larger than %d", tt.name, size.Name, b.Size(), size.MaxEdge)
+			}
+			if size.Name == "large" && b.Size() != tt.wantLarge {
+				t.Errorf("%s: large is %v, want %v", tt.name, b.Size(), tt.wantLarge)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package images
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Store: writes photo sizes under Dir, which is served at URLPrefix
+type Store struct {
+	Dir       string
+	URLPrefix string
+}
+
+// Save: writes the sizes of a room photo and returns the url of each size
+func (s Store) Save(roomId int, variants map[string][]byte) (map[string]string, error) {
+	// * A random name so photos can't be guessed or overwrite each other
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	name := hex.EncodeToString(b)
+
+	rel := path.Join("rooms", fmt.Sprint(roomId))
+	if err := os.MkdirAll(filepath.Join(s.Dir, filepath.FromSlash(rel)), 0o755); err != nil {
+		return nil, err
+	}
+
+	urls := map[string]string{}
+	for size, data := range variants {
+		file := path.Join(rel, name+"-"+size+".jpg")
+
+		err := os.WriteFile(filepath.Join(s.Dir, filepath.FromSlash(file)), data, 0o644)
+		if err != nil {
+			s.Remove(mapValues(urls)...)
+			return nil, err
+		}
+		urls[size] = strings.TrimSuffix(s.URLPrefix, "/") + "/" + file
+	}
+
+	return urls, nil
+}
+
+// Remove: deletes the files behind urls, urls outside URLPrefix such as /static images are left alone
+func (s Store) Remove(urls ...string) error {
+	var firstErr error
+
+	for _, url := range urls {
+		rel, ok := strings.CutPrefix(url, strings.TrimSuffix(s.URLPrefix, "/")+"/")
+		if !ok || rel == "" {
+			continue
+		}
+
+		// * Cleaning as an absolute path keeps .. from leaving the store directory
+		file := filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+rel)))
+
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,15 @@
+package metrics
+
+// * Metrics reported by the application
+var (
+	HTTPRequests    = NewCounterVec("http_requests_total", "HTTP requests by method, chi route pattern and status.", "method", "route", "status")
+	HTTPDuration    = NewHistogramVec("http_request_duration_seconds", "HTTP request latency by method and chi route pattern.", nil, "method", "route")
+	DBQueryDuration = NewHistogramVec("db_query_duration_seconds", "Database query latency by repository method.", nil, "method")
+
+	MailSent         = NewCounterVec("mail_sent_total", "Mails sent successfully.")
+	MailSendFailures = NewCounterVec("mail_send_failures_total", "Mails which could not be sent.")
+
+	ReservationsCreated   = NewCounterVec("reservations_created_total", "Reservations created.")
+	ReservationsCancelled = NewCounterVec("reservations_cancelled_total", "Reservations cancelled.")
+	EmptySearches         = NewCounterVec("availability_searches_empty_total", "Availability searches which found no room.")
+)
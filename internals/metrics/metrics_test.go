@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// * Metrics are built without the New functions, so they stay out of the default registry served by the app
+
+func TestCounterVecWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		incs   [][]string
+		want   string
+	}{
+		{
+			name: "unlabelled before its first increment",
+			want: "# HELP jobs_total Jobs run\n# TYPE jobs_total counter\njobs_total 0\n",
+		},
+		{
+			name: "unlabelled",
+			incs: [][]string{{}, {}},
+			want: "# HELP jobs_total Jobs run\n# TYPE jobs_total counter\njobs_total 2\n",
+		},
+		{
+			name:   "labelled series sorted by label values",
+			labels: []string{"method", "code"},
+			incs:   [][]string{{"POST", "303"}, {"GET", "200"}, {"GET", "200"}},
+			want: "# HELP jobs_total Jobs run\n# TYPE jobs_total counter\n" +
+				`jobs_total{method="GET",code="200"} 2` + "\n" +
+				`jobs_total{method="POST",code="303"} 1` + "\n",
+		},
+		{
+			name:   "label values escaped",
+			labels: []string{"path"},
+			incs:   [][]string{{"a\"b\\c\nd"}},
+			want:   "# HELP jobs_total Jobs run\n# TYPE jobs_total counter\n" + `jobs_total{path="a\"b\\c\nd"} 1` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		c := &CounterVec{newVec("jobs_total", "Jobs run", "counter", tt.labels)}
+		for _, labels := range tt.incs {
+			c.Inc(labels...)
+		}
+
+		var out strings.Builder
+		c.write(&out)
+		if out.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestHistogramVecWrite(t *testing.T) {
+	h := &HistogramVec{vec: newVec("query_seconds", "Query time", "histogram", []string{"query"}), buckets: []float64{.1, 1}}
+	h.Observe(.05, "Rooms")
+	h.Observe(.5, "Rooms")
+	h.Observe(2, "Rooms")
+
+	want := `# HELP query_seconds Query time
+# TYPE query_seconds histogram
+query_seconds_bucket{query="Rooms",le="0.1"} 1
+query_seconds_bucket{query="Rooms",le="1"} 2
+query_seconds_bucket{query="Rooms",le="+Inf"} 3
+query_seconds_sum{query="Rooms"} 2.55
+query_seconds_count{query="Rooms"} 3
+`
+
+	var out strings.Builder
+	h.write(&out)
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRegistryWriteSortsByName(t *testing.T) {
+	reg := &Registry{}
+	reg.register(&GaugeFunc{metricName: "b_gauge", help: "B", fn: func() float64 { return 1.5 }})
+	reg.register(&CounterVec{newVec("a_total", "A", "counter", nil)})
+
+	want := "# HELP a_total A\n# TYPE a_total counter\na_total 0\n" +
+		"# HELP b_gauge B\n# TYPE b_gauge gauge\nb_gauge 1.5\n"
+
+	var out strings.Builder
+	reg.Write(&out)
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestWrongNumberOfLabelValuesPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	c := &CounterVec{newVec("jobs_total", "Jobs run", "counter", []string{"job"})}
+	c.Inc()
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{2.5, "2.5"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := formatFloat(tt.value); got != tt.want {
+			t.Errorf("formatFloat(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,653 @@
+package migrate
+
+// * A translator for the subset of fizz used by the migrations in this repo, so they run without the soda tool
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// * fizzCall is one statement such as add_index("users", "email", {"unique": true}), Block holds the t.Column calls of create_table
+type fizzCall struct {
+	Name  string
+	Args  []interface{}
+	Raw   string
+	Block []fizzCall
+}
+
+type fizzParser struct {
+	src string
+	pos int
+}
+
+// FizzToSQL: translates a fizz migration to postgres statements
+func FizzToSQL(src string) ([]string, error) {
+	p := &fizzParser{src: src}
+
+	var statements []string
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return statements, nil
+		}
+
+		call, err := p.call()
+		if err != nil {
+			return nil, err
+		}
+
+		stmt, err := translate(call)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+}
+
+func (p *fizzParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("fizz line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *fizzParser) skipSpace() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//") || c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *fizzParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *fizzParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *fizzParser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := rune(p.src[p.pos])
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// call: parses name(args) with an optional { block } of further calls
+func (p *fizzParser) call() (fizzCall, error) {
+	call := fizzCall{Name: p.ident()}
+	if call.Name == "" {
+		return call, p.errorf("expected a statement")
+	}
+
+	if err := p.expect('('); err != nil {
+		return call, err
+	}
+
+	// * sql() may hold unquoted sql, which is taken as is up to the closing parenthesis
+	if call.Name == "sql" && p.peek() != '"' && p.peek() != '\'' && p.peek() != '`' {
+		depth := 1
+		start := p.pos
+		for ; p.pos < len(p.src); p.pos++ {
+			switch p.src[p.pos] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		if depth != 0 {
+			return call, p.errorf("unclosed sql(")
+		}
+		call.Raw = strings.TrimSpace(p.src[start:p.pos])
+		p.pos++
+		return call, nil
+	}
+
+	for p.peek() != ')' {
+		value, err := p.value()
+		if err != nil {
+			return call, err
+		}
+		call.Args = append(call.Args, value)
+
+		if p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != ')' {
+			return call, p.errorf("expected , or ) in %s", call.Name)
+		}
+	}
+	p.pos++
+
+	if p.peek() == '{' {
+		p.pos++
+		for p.peek() != '}' {
+			if p.peek() == 0 {
+				return call, p.errorf("unclosed block of %s", call.Name)
+			}
+			inner, err := p.call()
+			if err != nil {
+				return call, err
+			}
+			call.Block = append(call.Block, inner)
+		}
+		p.pos++
+	}
+
+	return call, nil
+}
+
+func (p *fizzParser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'' || c == '`':
+		return p.str()
+	case c == '[':
+		p.pos++
+		var list []interface{}
+		for p.peek() != ']' {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != ']' {
+				return nil, p.errorf("expected , or ] in list")
+			}
+		}
+		p.pos++
+		return list, nil
+	case c == '{':
+		p.pos++
+		obj := map[string]interface{}{}
+		for p.peek() != '}' {
+			key, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(':'); err != nil {
+				return nil, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = v
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != '}' {
+				return nil, p.errorf("expected , or } in options")
+			}
+		}
+		p.pos++
+		return obj, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", p.src[start:p.pos])
+		}
+		return n, nil
+	default:
+		word := p.ident()
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil", "null":
+			return nil, nil
+		}
+		return nil, p.errorf("unexpected %q", word)
+	}
+}
+
+func (p *fizzParser) str() (string, error) {
+	quote := p.peek()
+	if quote != '"' && quote != '\'' && quote != '`' {
+		return "", p.errorf("expected a string")
+	}
+	p.pos++
+
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		if c == '\\' && quote != '`' && p.pos < len(p.src) {
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+			continue
+		}
+		if c == quote {
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+	}
+
+	return "", p.errorf("unclosed string")
+}
+
+// * Helpers to read call arguments
+
+func argString(call fizzCall, i int) (string, error) {
+	if i >= len(call.Args) {
+		return "", fmt.Errorf("%s: missing argument %d", call.Name, i+1)
+	}
+	s, ok := call.Args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: argument %d must be a string", call.Name, i+1)
+	}
+	return s, nil
+}
+
+func argStrings(call fizzCall, i int) ([]string, error) {
+	if i >= len(call.Args) {
+		return nil, fmt.Errorf("%s: missing argument %d", call.Name, i+1)
+	}
+	switch v := call.Args[i].(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: argument %d must be a list of strings", call.Name, i+1)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("%s: argument %d must be a string or a list", call.Name, i+1)
+}
+
+func argOptions(call fizzCall, i int) map[string]interface{} {
+	if i < len(call.Args) {
+		if opts, ok := call.Args[i].(map[string]interface{}); ok {
+			return opts
+		}
+	}
+	return map[string]interface{}{}
+}
+
+func optBool(opts map[string]interface{}, key string) bool {
+	b, _ := opts[key].(bool)
+	return b
+}
+
+func optString(opts map[string]interface{}, key string) string {
+	s, _ := opts[key].(string)
+	return s
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// sqlType: maps a fizz column type to postgres
+func sqlType(colType string, opts map[string]interface{}) string {
+	switch strings.ToLower(colType) {
+	case "string", "varchar":
+		size := 255
+		if s, ok := opts["size"].(float64); ok {
+			size = int(s)
+		}
+		return fmt.Sprintf("VARCHAR (%d)", size)
+	case "text":
+		return "text"
+	case "integer", "int":
+		return "integer"
+	case "bigint":
+		return "bigint"
+	case "bool", "boolean":
+		return "boolean"
+	case "date":
+		return "date"
+	case "time", "timestamp", "datetime":
+		return "timestamp"
+	case "uuid":
+		return "UUID"
+	case "float":
+		return "numeric"
+	case "decimal":
+		return "DECIMAL"
+	case "json":
+		return "json"
+	case "jsonb":
+		return "jsonb"
+	case "blob":
+		return "bytea"
+	}
+	return colType
+}
+
+// sqlLiteral: renders a default value
+func sqlLiteral(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return fmt.Sprint(v)
+}
+
+// columnDefinition: renders a column of create_table or add_column, fizz columns are not null unless {"null": true}
+func columnDefinition(name, colType string, opts map[string]interface{}) string {
+	lower := strings.ToLower(colType)
+	if optBool(opts, "primary") && (lower == "integer" || lower == "int") {
+		return quoteIdent(name) + " SERIAL PRIMARY KEY"
+	}
+
+	def := quoteIdent(name) + " " + sqlType(colType, opts)
+	if optBool(opts, "primary") {
+		def += " PRIMARY KEY"
+	}
+	if !optBool(opts, "null") {
+		def += " NOT NULL"
+	}
+	if v, ok := opts["default"]; ok {
+		def += " DEFAULT " + sqlLiteral(v)
+	}
+	if raw := optString(opts, "default_raw"); raw != "" {
+		def += " DEFAULT " + raw
+	}
+	return def
+}
+
+func translate(call fizzCall) (string, error) {
+	switch call.Name {
+	case "sql":
+		if call.Raw != "" {
+			return call.Raw, nil
+		}
+		return argString(call, 0)
+
+	case "create_table":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+
+		var columns []string
+		seen := map[string]bool{}
+		timestamps := true
+
+		for _, inner := range call.Block {
+			switch inner.Name {
+			case "t.Column":
+				name, err := argString(inner, 0)
+				if err != nil {
+					return "", err
+				}
+				colType, err := argString(inner, 1)
+				if err != nil {
+					return "", err
+				}
+				seen[name] = true
+				columns = append(columns, columnDefinition(name, colType, argOptions(inner, 2)))
+			case "t.Timestamps":
+				timestamps = true
+			case "t.DisableTimestamps":
+				timestamps = false
+			case "t.PrimaryKey":
+				keys, err := argStrings(inner, 0)
+				if err != nil {
+					return "", err
+				}
+				columns = append(columns, "PRIMARY KEY("+quoteIdents(keys)+")")
+			default:
+				return "", fmt.Errorf("create_table: unsupported %s", inner.Name)
+			}
+		}
+
+		// * fizz adds the timestamps to every table
+		if timestamps {
+			for _, name := range []string{"created_at", "updated_at"} {
+				if !seen[name] {
+					columns = append(columns, quoteIdent(name)+" timestamp NOT NULL")
+				}
+			}
+		}
+
+		return fmt.Sprintf("CREATE TABLE %s (\n%s\n);", quoteIdent(table), "  "+strings.Join(columns, ",\n  ")), nil
+
+	case "drop_table":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("DROP TABLE %s;", quoteIdent(table)), nil
+
+	case "rename_table":
+		from, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		to, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", quoteIdent(from), quoteIdent(to)), nil
+
+	case "add_column":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		name, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		colType, err := argString(call, 2)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", quoteIdent(table), columnDefinition(name, colType, argOptions(call, 3))), nil
+
+	case "drop_column":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		name, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", quoteIdent(table), quoteIdent(name)), nil
+
+	case "rename_column":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		from, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		to, err := argString(call, 2)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", quoteIdent(table), quoteIdent(from), quoteIdent(to)), nil
+
+	case "change_column":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		name, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		colType, err := argString(call, 2)
+		if err != nil {
+			return "", err
+		}
+		opts := argOptions(call, 3)
+
+		col := quoteIdent(name)
+		alters := []string{fmt.Sprintf("ALTER COLUMN %s TYPE %s", col, sqlType(colType, opts))}
+		if optBool(opts, "null") {
+			alters = append(alters, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", col))
+		} else {
+			alters = append(alters, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", col))
+		}
+		if v, ok := opts["default"]; ok {
+			alters = append(alters, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", col, sqlLiteral(v)))
+		} else {
+			alters = append(alters, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", col))
+		}
+		return fmt.Sprintf("ALTER TABLE %s %s;", quoteIdent(table), strings.Join(alters, ", ")), nil
+
+	case "add_index":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		columns, err := argStrings(call, 1)
+		if err != nil {
+			return "", err
+		}
+		opts := argOptions(call, 2)
+
+		name := optString(opts, "name")
+		if name == "" {
+			name = table + "_" + strings.Join(columns, "_") + "_idx"
+		}
+
+		unique := ""
+		if optBool(opts, "unique") {
+			unique = "UNIQUE "
+		}
+		return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s);", unique, quoteIdent(name), quoteIdent(table), quoteIdents(columns)), nil
+
+	case "drop_index":
+		name, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("DROP INDEX IF EXISTS %s;", quoteIdent(name)), nil
+
+	case "rename_index":
+		from, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		to, err := argString(call, 2)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ALTER INDEX %s RENAME TO %s;", quoteIdent(from), quoteIdent(to)), nil
+
+	case "add_foreign_key":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		column, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+
+		refs := argOptions(call, 2)
+		if len(refs) != 1 {
+			return "", fmt.Errorf("add_foreign_key: expected exactly one referenced table")
+		}
+		var refTable string
+		for name := range refs {
+			refTable = name
+		}
+		refColumns, err := argStrings(fizzCall{Name: call.Name, Args: []interface{}{refs[refTable]}}, 0)
+		if err != nil {
+			return "", err
+		}
+
+		opts := argOptions(call, 3)
+		name := optString(opts, "name")
+		if name == "" {
+			name = fmt.Sprintf("%s_%s_%s_fk", table, refTable, strings.Join(refColumns, "_"))
+		}
+
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+			quoteIdent(table), quoteIdent(name), quoteIdent(column), quoteIdent(refTable), quoteIdents(refColumns))
+
+		// * Sorted so the generated sql is stable
+		keys := make([]string, 0, len(opts))
+		for key := range opts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			action := strings.ToUpper(optString(opts, key))
+			switch key {
+			case "on_delete":
+				stmt += " ON DELETE " + action
+			case "on_update":
+				stmt += " ON UPDATE " + action
+			}
+		}
+		return stmt + ";", nil
+
+	case "drop_foreign_key":
+		table, err := argString(call, 0)
+		if err != nil {
+			return "", err
+		}
+		name, err := argString(call, 1)
+		if err != nil {
+			return "", err
+		}
+		ifExists := ""
+		if optBool(argOptions(call, 2), "if_exists") {
+			ifExists = "IF EXISTS "
+		}
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s%s;", quoteIdent(table), ifExists, quoteIdent(name)), nil
+	}
+
+	return "", fmt.Errorf("unsupported fizz statement %s", call.Name)
+}
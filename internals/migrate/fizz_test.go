@@ -0,0 +1,153 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFizzToSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		fizz string
+		want []string
+	}{
+		{
+			name: "create table adds timestamps",
+			fizz: `create_table("rooms") {
+  t.Column("id", "integer", {"primary": true})
+  t.Column("room_name", "string", {"default": ""})
+  t.Column("notes", "text", {"null": true})
+  t.Column("capacity", "integer", {"default": 2})
+}`,
+			want: []string{`CREATE TABLE "rooms" (
+  "id" SERIAL PRIMARY KEY,
+  "room_name" VARCHAR (255) NOT NULL DEFAULT '',
+  "notes" text,
+  "capacity" integer NOT NULL DEFAULT 2,
+  "created_at" timestamp NOT NULL,
+  "updated_at" timestamp NOT NULL
+);`},
+		},
+		{
+			name: "create table without timestamps",
+			fizz: `create_table("tags") {
+  t.Column("name", "string", {"size": 20})
+  t.DisableTimestamps()
+}`,
+			want: []string{`CREATE TABLE "tags" (
+  "name" VARCHAR (20) NOT NULL
+);`},
+		},
+		{
+			name: "several statements and comments",
+			fizz: `// rooms are renamed
+drop_table("holds")
+rename_table("room", "rooms")`,
+			want: []string{`DROP TABLE "holds";`, `ALTER TABLE "room" RENAME TO "rooms";`},
+		},
+		{
+			name: "columns",
+			fizz: `add_column("reservations", "status", "string", {"size": 20, "default": "confirmed"})
+drop_column("reservations", "notes")
+rename_column("reservations", "start", "start_date")`,
+			want: []string{
+				`ALTER TABLE "reservations" ADD COLUMN "status" VARCHAR (20) NOT NULL DEFAULT 'confirmed';`,
+				`ALTER TABLE "reservations" DROP COLUMN "notes";`,
+				`ALTER TABLE "reservations" RENAME COLUMN "start" TO "start_date";`,
+			},
+		},
+		{
+			name: "change column",
+			fizz: `change_column("room_restrictions", "reservation_id", "integer", {"null": true})`,
+			want: []string{`ALTER TABLE "room_restrictions" ALTER COLUMN "reservation_id" TYPE integer, ALTER COLUMN "reservation_id" DROP NOT NULL, ALTER COLUMN "reservation_id" DROP DEFAULT;`},
+		},
+		{
+			name: "indices",
+			fizz: `add_index("payments", ["provider", "reference"], {"unique": true})
+add_index("users", "email", {"name": "users_email_idx"})
+drop_index("payments", "payments_provider_reference_idx")`,
+			want: []string{
+				`CREATE UNIQUE INDEX "payments_provider_reference_idx" ON "payments" ("provider", "reference");`,
+				`CREATE INDEX "users_email_idx" ON "users" ("email");`,
+				`DROP INDEX IF EXISTS "payments_provider_reference_idx";`,
+			},
+		},
+		{
+			name: "foreign keys",
+			fizz: `add_foreign_key("payments", "reservation_id", {"reservations": ["id"]}, {
+    "on_update": "cascade",
+    "on_delete": "cascade",
+})
+drop_foreign_key("payments", "payments_reservations_id_fk", {})`,
+			want: []string{
+				`ALTER TABLE "payments" ADD CONSTRAINT "payments_reservations_id_fk" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON DELETE CASCADE ON UPDATE CASCADE;`,
+				`ALTER TABLE "payments" DROP CONSTRAINT "payments_reservations_id_fk";`,
+			},
+		},
+		{
+			name: "quoted and unquoted sql",
+			fizz: `sql("update rooms set active = true")
+sql(update rooms set capacity = greatest(capacity, 1))`,
+			want: []string{`update rooms set active = true`, `update rooms set capacity = greatest(capacity, 1)`},
+		},
+		{
+			name: "nothing",
+			fizz: "\n// no statements\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := FizzToSQL(tt.fizz)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFizzToSQLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fizz string
+	}{
+		{"unknown statement", `drop_everything("rooms")`},
+		{"unclosed call", `drop_table("rooms"`},
+		{"unclosed block", `create_table("rooms") { t.Column("id", "integer", {})`},
+		{"unsupported column call", `create_table("rooms") { t.Index("id") }`},
+		{"missing table", `drop_table()`},
+		{"unclosed sql", `sql(update rooms set x = (1)`},
+	}
+
+	for _, tt := range tests {
+		if _, err := FizzToSQL(tt.fizz); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// * Every migration of the app must translate, so a fizz statement the translator doesn't know fails here and not at deploy
+func TestFizzToSQLMigrations(t *testing.T) {
+	files, err := filepath.Glob("../../migrations/*.fizz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations found")
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := FizzToSQL(string(src)); err != nil {
+			t.Errorf("%s: %v", filepath.Base(file), err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package migrate
+
+// * Runs the fizz and sql migrations without soda, tracking them in soda's schema_migration table so either tool can be used on the same database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// * Versions are stored in the same table soda uses
+const schemaTable = "schema_migration"
+
+// * 20231210091237_create_users_table.up.fizz or 20231223114922_seed_rooms_table.postgres.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_([^.]+)(\.[a-z]+)?\.(up|down)\.(fizz|sql)$`)
+
+// Migration: is one version with its up and down files
+type Migration struct {
+	Version string
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status: is a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Migrator: applies the migrations found in FS to DB
+type Migrator struct {
+	DB         *sql.DB
+	FS         fs.FS
+	Migrations []Migration
+}
+
+// New: reads the migrations at the root of fsys, files for other databases and sub directories are ignored
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[string]*Migration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, name, dialect, direction := match[1], match[2], match[3], match[4]
+		if dialect != "" && dialect != ".postgres" {
+			continue
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.Up = entry.Name()
+		} else {
+			m.Down = entry.Name()
+		}
+	}
+
+	migrator := &Migrator{DB: db, FS: fsys}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s_%s has no up file", m.Version, m.Name)
+		}
+		migrator.Migrations = append(migrator.Migrations, *m)
+	}
+	sort.Slice(migrator.Migrations, func(i, j int) bool {
+		return migrator.Migrations[i].Version < migrator.Migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Statements: returns the sql statements of a migration file, translating fizz
+func (m *Migrator) Statements(file string) ([]string, error) {
+	b, err := fs.ReadFile(m.FS, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if path.Ext(file) == ".sql" {
+		if strings.TrimSpace(string(b)) == "" {
+			return nil, nil
+		}
+		return []string{string(b)}, nil
+	}
+
+	statements, err := FizzToSQL(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return statements, nil
+}
+
+// ensureSchemaTable: creates schema_migration the way soda does if it is missing
+func (m *Migrator) ensureSchemaTable(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `create table if not exists `+schemaTable+` (version varchar(14) not null)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `create unique index if not exists `+schemaTable+`_version_idx on `+schemaTable+` (version)`)
+	return err
+}
+
+// applied: returns the versions already in schema_migration
+func (m *Migrator) applied(ctx context.Context) (map[string]bool, error) {
+	if err := m.ensureSchemaTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `select version from `+schemaTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions[version] = true
+	}
+
+	return versions, rows.Err()
+}
+
+// Status: returns every migration in order with whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		statuses[i] = Status{Migration: migration, Applied: applied[migration.Version]}
+	}
+
+	return statuses, nil
+}
+
+// Up: applies every pending migration in order, each in its own transaction, and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.Migrations {
+		if applied[migration.Version] {
+			continue
+		}
+
+		err = m.run(ctx, migration.Up, `insert into `+schemaTable+` (version) values ($1)`, migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrating %s_%s up: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down: rolls back the last steps applied migrations, newest first, and returns the ones rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.Migrations[i]
+		if !applied[migration.Version] {
+			continue
+		}
+
+		if migration.Down == "" {
+			return done, fmt.Errorf("migration %s_%s has no down file", migration.Version, migration.Name)
+		}
+
+		err = m.run(ctx, migration.Down, `delete from `+schemaTable+` where version = $1`, migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("migrating %s_%s down: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// run: executes the statements of file and records the version in one transaction
+func (m *Migrator) run(ctx context.Context, file, record, version string) error {
+	statements, err := m.Statements(file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range statements {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, record, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Seed: runs the sql files in the seeds directory of fsys in name order, each file must be safe to run more than once
+func Seed(ctx context.Context, db *sql.DB, fsys fs.FS) ([]string, error) {
+	files, err := fs.Glob(fsys, "seeds/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var done []string
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return done, err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		_, err = db.ExecContext(ctx, string(b))
+		cancel()
+		if err != nil {
+			return done, fmt.Errorf("seeding %s: %w", file, err)
+		}
+		done = append(done, file)
+	}
+
+	return done, nil
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -18,12 +21,188 @@ type User struct {
 
 // Rooms: is the room model
 type Room struct {
+	ID          int
+	RoomName    string
+	Slug        string
+	Description string
+	Capacity    int
+	Amenities   []string
+	Active      bool
+	Photos      []RoomPhoto
+	StayRules   []StayRule
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// * Prices are in cents per night, the nightly rate covers IncludedGuests and each guest above it pays the extra fee
+	NightlyRate    int
+	IncludedGuests int
+	ExtraAdultFee  int
+	ExtraChildFee  int
+}
+
+// Fits: reports whether adults and children together fit in the room
+func (r Room) Fits(adults, children int) bool {
+	return adults >= 1 && children >= 0 && adults+children <= r.Capacity
+}
+
+// NightlyPrice: returns the price of one night in cents, the included guests are counted as adults first
+func (r Room) NightlyPrice(adults, children int) int {
+	extraAdults := max(0, adults-r.IncludedGuests)
+	extraChildren := max(0, children-max(0, r.IncludedGuests-adults))
+
+	return r.NightlyRate + extraAdults*r.ExtraAdultFee + extraChildren*r.ExtraChildFee
+}
+
+// Price: returns the price of a stay in cents
+func (r Room) Price(nights, adults, children int) int {
+	return nights * r.NightlyPrice(adults, children)
+}
+
+// RoomPhoto: is a photo of a room, shown in Position order, URL is the largest size
+type RoomPhoto struct {
 	ID        int
-	RoomName  string
+	RoomID    int
+	URL       string
+	ThumbURL  string
+	MediumURL string
+	Position  int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Thumb: returns the url of the thumbnail, photos added before uploads only have URL
+func (p RoomPhoto) Thumb() string {
+	if p.ThumbURL != "" {
+		return p.ThumbURL
+	}
+	return p.URL
+}
+
+// Medium: returns the url of the medium size
+func (p RoomPhoto) Medium() string {
+	if p.MediumURL != "" {
+		return p.MediumURL
+	}
+	return p.URL
+}
+
+// StayRule: limits the stays of a room between StartDate and EndDate, both included
+// * MinNights, MaxNights and ClosedToArrival apply to stays arriving in the range, ClosedToDeparture to stays leaving in it, a MaxNights of 0 means no maximum
+type StayRule struct {
+	ID                int
+	RoomID            int
+	StartDate         time.Time
+	EndDate           time.Time
+	MinNights         int
+	MaxNights         int
+	ClosedToArrival   Weekdays
+	ClosedToDeparture Weekdays
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// Covers: reports whether day falls in the range of the rule
+func (r StayRule) Covers(day time.Time) bool {
+	return !day.Before(r.StartDate) && !day.After(r.EndDate)
+}
+
+// Check: returns why a stay from start to end breaks the rule, nil when it doesn't
+func (r StayRule) Check(start, end time.Time) error {
+	nights := int(end.Sub(start).Hours() / 24)
+
+	if r.Covers(start) {
+		if nights < r.MinNights {
+			return fmt.Errorf("stays arriving %s must be at least %d nights", r.period(), r.MinNights)
+		}
+		if r.MaxNights > 0 && nights > r.MaxNights {
+			return fmt.Errorf("stays arriving %s can be at most %d nights", r.period(), r.MaxNights)
+		}
+		if r.ClosedToArrival.Has(start.Weekday()) {
+			return fmt.Errorf("there are no arrivals on %s %s", start.Weekday(), r.period())
+		}
+	}
+
+	if r.Covers(end) && r.ClosedToDeparture.Has(end.Weekday()) {
+		return fmt.Errorf("there are no departures on %s %s", end.Weekday(), r.period())
+	}
+
+	return nil
+}
+
+// Description: lists the limits of the rule for guests, e.g. "at least 3 nights, no arrivals on Sunday"
+func (r StayRule) Description() string {
+	var limits []string
+	if r.MinNights > 1 {
+		limits = append(limits, fmt.Sprintf("at least %d nights", r.MinNights))
+	}
+	if r.MaxNights > 0 {
+		limits = append(limits, fmt.Sprintf("at most %d nights", r.MaxNights))
+	}
+	if r.ClosedToArrival != 0 {
+		limits = append(limits, "no arrivals on "+r.ClosedToArrival.String())
+	}
+	if r.ClosedToDeparture != 0 {
+		limits = append(limits, "no departures on "+r.ClosedToDeparture.String())
+	}
+	return strings.Join(limits, ", ")
+}
+
+func (r StayRule) period() string {
+	return fmt.Sprintf("from %s to %s", r.StartDate.Format("Jan 2, 2006"), r.EndDate.Format("Jan 2, 2006"))
+}
+
+// CheckStay: returns why a stay from start to end can't be booked in the room, nil when it can
+func (r Room) CheckStay(start, end time.Time) error {
+	if !end.After(start) {
+		return errors.New("departure must be after arrival")
+	}
+
+	for _, rule := range r.StayRules {
+		if err := rule.Check(start, end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Weekdays: is a set of days of the week, bit n is set for time.Weekday(n)
+type Weekdays int
+
+// Has: reports whether day is in the set
+func (d Weekdays) Has(day time.Weekday) bool {
+	return d&(1<<day) != 0
+}
+
+// With: returns the set with day added
+func (d Weekdays) With(day time.Weekday) Weekdays {
+	return d | 1<<day
+}
+
+// Days: returns the days in the set from Sunday to Saturday
+func (d Weekdays) Days() []time.Weekday {
+	var days []time.Weekday
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if d.Has(day) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// String: returns the names of the days, e.g. "Friday and Saturday"
+func (d Weekdays) String() string {
+	var names []string
+	for _, day := range d.Days() {
+		names = append(names, day.String())
+	}
+
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
 // Restrictions: is the restriction model
 type Restriction struct {
 	ID              int
@@ -41,11 +220,272 @@ type Reservation struct {
 	StartDate time.Time
 	EndDate   time.Time
 	RoomId    int
+	Status    string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
+
+	Adults   int
+	Children int
+	// * TotalPrice is the price in cents when the reservation was made, later rate changes don't affect it
+	TotalPrice int
+
+	// * ConfirmationCode is quoted by guests instead of the id, e.g. BNB-7K3Q9X
+	ConfirmationCode string
+
+	// * RatePlanName, DiscountPercent and Policy are copied from the rate plan booked, later changes to the plan don't affect the reservation
+	// * Reservations made without a rate plan have a zero Policy, which charges nothing on cancellation
+	RatePlanName    string
+	DiscountPercent int
+	Policy          CancellationPolicy
+	// * CancellationFee is what was charged when the reservation was cancelled
+	CancellationFee int
+}
+
+// Nights: returns the number of nights between the start and end date
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// Guests: returns the number of adults and children
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+// PlanPrice: applies the discount of the rate plan booked to a price in cents
+func (r Reservation) PlanPrice(price int) int {
+	return discounted(price, r.DiscountPercent)
 }
 
+// CancellationFeeOn: returns the fee in cents for cancelling the reservation on day under the policy it was booked with
+func (r Reservation) CancellationFeeOn(day time.Time) int {
+	return r.Policy.Fee(r.TotalPrice, r.StartDate, day)
+}
+
+// Cancelled: reports whether the reservation has been cancelled
+func (r Reservation) Cancelled() bool {
+	return r.Status == ReservationStatusCancelled
+}
+
+// * Reservation statuses stored in reservations.status
+const (
+	ReservationStatusConfirmed = "confirmed"
+	ReservationStatusCancelled = "cancelled"
+)
+
+// * Confirmation codes are ConfirmationCodePrefix and ConfirmationCodeLength characters of ConfirmationCodeAlphabet
+// * The alphabet leaves out 0, O, 1, I, L and U so a code read out over the phone can't be mistaken
+const (
+	ConfirmationCodePrefix   = "BNB-"
+	ConfirmationCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTVWXYZ"
+	ConfirmationCodeLength   = 6
+)
+
+// * User access levels stored in users.access_level, admins are created with the create-admin command
+const (
+	AccessLevelUser  = 2
+	AccessLevelAdmin = 3
+)
+
+// StayOption: is a stay which can be booked, one room from StartDate to EndDate
+type StayOption struct {
+	Room      Room
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// Nights: returns the number of nights of the stay
+func (o StayOption) Nights() int {
+	return int(o.EndDate.Sub(o.StartDate).Hours() / 24)
+}
+
+// Suggestions: are offered when the requested dates can't be booked
+// * Earlier and Later are the rooms free at the nearest window of the same length, SplitStay covers the dates with consecutive stays in different rooms
+type Suggestions struct {
+	Earlier   []StayOption
+	Later     []StayOption
+	SplitStay []StayOption
+}
+
+// Any: reports whether there is something to suggest
+func (s Suggestions) Any() bool {
+	return len(s.Earlier) > 0 || len(s.Later) > 0 || len(s.SplitStay) > 0
+}
+
+// RoomHold: keeps a room for the guest filling in the reservation form, until ExpiresAt or until they book
+// * Holder is a random key kept in the guest's session, availability ignores the holds of the session asking
+type RoomHold struct {
+	ID        int
+	RoomID    int
+	StartDate time.Time
+	EndDate   time.Time
+	Holder    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// * Statuses of a payment, money is authorized at booking and captured, voided or refunded later
+const (
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentVoided     = "voided"
+	PaymentRefunded   = "refunded"
+	PaymentFailed     = "failed"
+)
+
+// * Currency every payment is made in, prices are shown in dollars
+const PaymentCurrency = "usd"
+
+// Payment: is money taken for a reservation through a payment provider, amounts are in cents
+// * Reference is the provider's id of the payment, Amount what was authorized
+type Payment struct {
+	ID             int
+	ReservationID  int
+	Provider       string
+	Reference      string
+	Status         string
+	Amount         int
+	CapturedAmount int
+	RefundedAmount int
+	Currency       string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Refundable: returns how much of the captured amount hasn't been refunded yet
+func (p Payment) Refundable() int {
+	return p.CapturedAmount - p.RefundedAmount
+}
+
+// PaymentEvent: is a change of a payment the provider told the app about, Amount is what was captured or refunded in all
+// * ID is the provider's id of the event, the same event may be sent more than once
+type PaymentEvent struct {
+	ID       string
+	Provider string
+	Status   string
+	Amount   int
+}
+
+// Apply: returns the payment after event, false when the event is older than what the payment went through since
+// * A payment only moves forward, authorized to captured, voided or failed and captured to refunded, and refunds only grow
+func (p Payment) Apply(event PaymentEvent) (Payment, bool) {
+	switch event.Status {
+	case PaymentCaptured, PaymentVoided, PaymentFailed:
+		if p.Status != PaymentAuthorized {
+			return p, false
+		}
+		p.Status = event.Status
+		if event.Status == PaymentCaptured {
+			p.CapturedAmount = event.Amount
+		}
+	case PaymentRefunded:
+		if p.Status != PaymentCaptured || event.Amount <= p.RefundedAmount {
+			return p, false
+		}
+		p.RefundedAmount = min(event.Amount, p.CapturedAmount)
+		if p.Refundable() == 0 {
+			p.Status = PaymentRefunded
+		}
+	default:
+		return p, false
+	}
+
+	return p, true
+}
+
+// CancellationPolicy: says what cancelling a reservation costs
+// * Cancelling at least FreeCancellationDays days before arrival is free, later it costs LatePenaltyPercent of the total, 0 days means it is never free
+type CancellationPolicy struct {
+	ID                   int
+	Name                 string
+	FreeCancellationDays int
+	LatePenaltyPercent   int
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// Fee: returns the fee in cents for cancelling on day a stay arriving on arrival which costs total
+func (p CancellationPolicy) Fee(total int, arrival, day time.Time) int {
+	daysBefore := int(arrival.Sub(day).Hours() / 24)
+	if p.FreeCancellationDays > 0 && daysBefore >= p.FreeCancellationDays {
+		return 0
+	}
+	return total * p.LatePenaltyPercent / 100
+}
+
+// Description: explains the policy to guests, e.g. "Free cancellation until 7 days before arrival, 50% of the total after"
+func (p CancellationPolicy) Description() string {
+	switch {
+	case p.LatePenaltyPercent == 0:
+		return "Free cancellation"
+	case p.FreeCancellationDays == 0 && p.LatePenaltyPercent == 100:
+		return "Non-refundable"
+	case p.FreeCancellationDays == 0:
+		return fmt.Sprintf("%d%% of the total is charged on cancellation", p.LatePenaltyPercent)
+	case p.LatePenaltyPercent == 100:
+		return fmt.Sprintf("Free cancellation until %d %s before arrival, non-refundable after", p.FreeCancellationDays, plural(p.FreeCancellationDays, "day", "days"))
+	default:
+		return fmt.Sprintf("Free cancellation until %d %s before arrival, %d%% of the total after", p.FreeCancellationDays, plural(p.FreeCancellationDays, "day", "days"), p.LatePenaltyPercent)
+	}
+}
+
+// RatePlan: is a way to book a room, at a discount of DiscountPercent on the nightly rates and under a cancellation policy
+type RatePlan struct {
+	ID                   int
+	RoomID               int
+	Name                 string
+	DiscountPercent      int
+	CancellationPolicyID int
+	Policy               CancellationPolicy
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// Price: applies the discount of the plan to a price in cents
+func (p RatePlan) Price(price int) int {
+	return discounted(price, p.DiscountPercent)
+}
+
+// discounted: takes percent off price, rounding the discount down to the cent
+func discounted(price, percent int) int {
+	return price - price*percent/100
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// * Statuses of a day in the availability calendar of a room
+const (
+	DayAvailable    = "available"
+	DayBooked       = "booked"
+	DayBlocked      = "blocked"
+	DayCheckInOnly  = "check_in_only"
+	DayCheckOutOnly = "check_out_only"
+)
+
+// CalendarDay: is the status of one day of a room, whether a stay can arrive on it, leave on it, both or neither
+type CalendarDay struct {
+	Date   time.Time
+	Status string
+}
+
+// Bookable: reports whether a stay can start on the day
+func (d CalendarDay) Bookable() bool {
+	return d.Status == DayAvailable || d.Status == DayCheckInOnly
+}
+
+// * Restriction ids seeded in the restrictions table
+const (
+	RestrictionCleaning    = 1
+	RestrictionOwner       = 2
+	RestrictionReservation = 3
+)
+
 // RoomRestrictions: is the reservation model
 type RoomRestriction struct {
 	ID            int
@@ -68,3 +508,33 @@ type MailData struct {
 	Subject string
 	Content string
 }
+
+// Actor: identifies who performed a change, a guest has UserID 0
+type Actor struct {
+	UserID int
+	Email  string
+	IP     string
+}
+
+// AuditEntry: is the audit log model, Changes holds the before/after json diff
+type AuditEntry struct {
+	ID         int
+	ActorID    int
+	ActorEmail string
+	IP         string
+	Action     string
+	Entity     string
+	EntityID   int
+	Changes    string
+	CreatedAt  time.Time
+}
+
+// AuditFilter: holds the optional filters for listing audit entries
+type AuditFilter struct {
+	Entity string
+	Action string
+	Actor  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
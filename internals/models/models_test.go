@@ -0,0 +1,258 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomFits(t *testing.T) {
+	room := Room{Capacity: 4}
+
+	tests := []struct {
+		name     string
+		adults   int
+		children int
+		want     bool
+	}{
+		{name: "one adult", adults: 1, want: true},
+		{name: "full room", adults: 2, children: 2, want: true},
+		{name: "over capacity", adults: 3, children: 2, want: false},
+		{name: "children alone", children: 2, want: false},
+		{name: "negative children", adults: 1, children: -1, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := room.Fits(tt.adults, tt.children); got != tt.want {
+			t.Errorf("%s: Fits(%d, %d) = %v, want %v", tt.name, tt.adults, tt.children, got, tt.want)
+		}
+	}
+}
+
+func TestRoomPrice(t *testing.T) {
+	room := Room{Capacity: 5, NightlyRate: 10000, IncludedGuests: 2, ExtraAdultFee: 2500, ExtraChildFee: 1000}
+
+	tests := []struct {
+		name     string
+		nights   int
+		adults   int
+		children int
+		want     int
+	}{
+		{name: "one guest pays the rate", nights: 1, adults: 1, want: 10000},
+		{name: "included guests", nights: 1, adults: 2, want: 10000},
+		{name: "child fills an included place", nights: 1, adults: 1, children: 1, want: 10000},
+		{name: "extra adult", nights: 1, adults: 3, want: 12500},
+		{name: "extra child", nights: 1, adults: 2, children: 1, want: 11000},
+		{name: "extra adult and children", nights: 1, adults: 3, children: 2, want: 14500},
+		{name: "every night is charged", nights: 3, adults: 2, children: 1, want: 33000},
+		{name: "no nights", nights: 0, adults: 3, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := room.Price(tt.nights, tt.adults, tt.children); got != tt.want {
+			t.Errorf("%s: Price(%d, %d, %d) = %d, want %d", tt.name, tt.nights, tt.adults, tt.children, got, tt.want)
+		}
+	}
+}
+
+func TestStayRuleCheck(t *testing.T) {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	// * July 2026, 3 to 7 nights, no arrivals on Sunday and no departures on Saturday
+	rule := StayRule{
+		StartDate:         date(time.July, 1),
+		EndDate:           date(time.July, 31),
+		MinNights:         3,
+		MaxNights:         7,
+		ClosedToArrival:   Weekdays(0).With(time.Sunday),
+		ClosedToDeparture: Weekdays(0).With(time.Saturday),
+	}
+
+	tests := []struct {
+		name    string
+		start   time.Time
+		end     time.Time
+		wantErr string
+	}{
+		{name: "allowed stay", start: date(time.July, 1), end: date(time.July, 6)},
+		{name: "too short", start: date(time.July, 1), end: date(time.July, 3), wantErr: "at least 3 nights"},
+		{name: "too long", start: date(time.July, 1), end: date(time.July, 10), wantErr: "at most 7 nights"},
+		{name: "arrival on sunday", start: date(time.July, 5), end: date(time.July, 8), wantErr: "no arrivals on Sunday"},
+		{name: "departure on saturday", start: date(time.July, 1), end: date(time.July, 4), wantErr: "no departures on Saturday"},
+		{name: "arriving before the rule", start: date(time.June, 28), end: date(time.July, 1)},
+		{name: "arriving before the rule leaving on saturday", start: date(time.June, 29), end: date(time.July, 11), wantErr: "no departures on Saturday"},
+		{name: "last day is included", start: date(time.July, 31), end: date(time.August, 1), wantErr: "at least 3 nights"},
+	}
+
+	for _, tt := range tests {
+		err := rule.Check(tt.start, tt.end)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error is %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRoomCheckStay(t *testing.T) {
+	start := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	room := Room{StayRules: []StayRule{{StartDate: start, EndDate: start.AddDate(0, 0, 30), MinNights: 2}}}
+
+	tests := []struct {
+		name    string
+		end     time.Time
+		wantErr bool
+	}{
+		{name: "zero nights", end: start, wantErr: true},
+		{name: "reversed dates", end: start.AddDate(0, 0, -2), wantErr: true},
+		{name: "breaks a rule", end: start.AddDate(0, 0, 1), wantErr: true},
+		{name: "allowed", end: start.AddDate(0, 0, 2)},
+	}
+
+	for _, tt := range tests {
+		if err := room.CheckStay(start, tt.end); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error is %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWeekdays(t *testing.T) {
+	tests := []struct {
+		days []time.Weekday
+		want string
+	}{
+		{nil, ""},
+		{[]time.Weekday{time.Sunday}, "Sunday"},
+		{[]time.Weekday{time.Saturday, time.Friday}, "Friday and Saturday"},
+		{[]time.Weekday{time.Monday, time.Sunday, time.Wednesday, time.Monday}, "Sunday, Monday and Wednesday"},
+	}
+
+	for _, tt := range tests {
+		var set Weekdays
+		for _, day := range tt.days {
+			set = set.With(day)
+		}
+
+		if got := set.String(); got != tt.want {
+			t.Errorf("Weekdays%v = %q, want %q", tt.days, got, tt.want)
+		}
+		for _, day := range tt.days {
+			if !set.Has(day) {
+				t.Errorf("Weekdays%v does not have %s", tt.days, day)
+			}
+		}
+		if len(tt.days) == 0 && set.Has(time.Sunday) {
+			t.Error("empty set has Sunday")
+		}
+	}
+}
+
+func TestCancellationPolicyFee(t *testing.T) {
+	arrival := time.Date(2026, time.June, 20, 0, 0, 0, 0, time.UTC)
+	flexible := CancellationPolicy{FreeCancellationDays: 7, LatePenaltyPercent: 50}
+
+	tests := []struct {
+		name   string
+		policy CancellationPolicy
+		days   int
+		want   int
+	}{
+		{"well before the free days end", flexible, 30, 0},
+		{"on the last free day", flexible, 7, 0},
+		{"the day after the free days", flexible, 6, 5000},
+		{"on arrival", flexible, 0, 5000},
+		{"non-refundable", CancellationPolicy{LatePenaltyPercent: 100}, 30, 10000},
+		{"free until arrival", CancellationPolicy{FreeCancellationDays: 1}, 0, 0},
+		{"penalty rounds down to the cent", CancellationPolicy{LatePenaltyPercent: 33}, 0, 3300},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Fee(10000, arrival, arrival.AddDate(0, 0, -tt.days)); got != tt.want {
+			t.Errorf("%s: Fee = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	if got := (CancellationPolicy{LatePenaltyPercent: 33}).Fee(101, arrival, arrival); got != 33 {
+		t.Errorf("Fee of 33%% of 101 cents = %d, want 33", got)
+	}
+}
+
+func TestCancellationPolicyDescription(t *testing.T) {
+	tests := []struct {
+		policy CancellationPolicy
+		want   string
+	}{
+		{CancellationPolicy{}, "Free cancellation"},
+		{CancellationPolicy{FreeCancellationDays: 7}, "Free cancellation"},
+		{CancellationPolicy{LatePenaltyPercent: 100}, "Non-refundable"},
+		{CancellationPolicy{LatePenaltyPercent: 20}, "20% of the total is charged on cancellation"},
+		{CancellationPolicy{FreeCancellationDays: 1, LatePenaltyPercent: 100}, "Free cancellation until 1 day before arrival, non-refundable after"},
+		{CancellationPolicy{FreeCancellationDays: 7, LatePenaltyPercent: 50}, "Free cancellation until 7 days before arrival, 50% of the total after"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Description(); got != tt.want {
+			t.Errorf("Description of %+v = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestRatePlanPrice(t *testing.T) {
+	tests := []struct {
+		discount int
+		price    int
+		want     int
+	}{
+		{0, 10000, 10000},
+		{10, 10000, 9000},
+		{10, 999, 900},
+		{100, 10000, 0},
+	}
+
+	for _, tt := range tests {
+		if got := (RatePlan{DiscountPercent: tt.discount}).Price(tt.price); got != tt.want {
+			t.Errorf("Price(%d) at %d%% off = %d, want %d", tt.price, tt.discount, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentApply(t *testing.T) {
+	authorized := Payment{Status: PaymentAuthorized, Amount: 10000}
+	captured := Payment{Status: PaymentCaptured, Amount: 10000, CapturedAmount: 8000}
+	partlyRefunded := Payment{Status: PaymentCaptured, Amount: 10000, CapturedAmount: 8000, RefundedAmount: 3000}
+
+	tests := []struct {
+		name        string
+		payment     Payment
+		event       PaymentEvent
+		want        Payment
+		wantApplied bool
+	}{
+		{"captured", authorized, PaymentEvent{Status: PaymentCaptured, Amount: 8000}, captured, true},
+		{"voided", authorized, PaymentEvent{Status: PaymentVoided}, Payment{Status: PaymentVoided, Amount: 10000}, true},
+		{"failed", authorized, PaymentEvent{Status: PaymentFailed}, Payment{Status: PaymentFailed, Amount: 10000}, true},
+		{"partly refunded", captured, PaymentEvent{Status: PaymentRefunded, Amount: 3000}, partlyRefunded, true},
+		{"fully refunded", partlyRefunded, PaymentEvent{Status: PaymentRefunded, Amount: 8000},
+			Payment{Status: PaymentRefunded, Amount: 10000, CapturedAmount: 8000, RefundedAmount: 8000}, true},
+		{"captured again", captured, PaymentEvent{Status: PaymentCaptured, Amount: 8000}, captured, false},
+		{"canceled after capture", captured, PaymentEvent{Status: PaymentVoided}, captured, false},
+		{"captured late after a refund", partlyRefunded, PaymentEvent{Status: PaymentCaptured, Amount: 8000}, partlyRefunded, false},
+		{"older refund", partlyRefunded, PaymentEvent{Status: PaymentRefunded, Amount: 2000}, partlyRefunded, false},
+		{"refund of a payment never captured", authorized, PaymentEvent{Status: PaymentRefunded, Amount: 2000}, authorized, false},
+		{"unknown status", authorized, PaymentEvent{Status: "disputed"}, authorized, false},
+	}
+
+	for _, tt := range tests {
+		got, applied := tt.payment.Apply(tt.event)
+		if got != tt.want || applied != tt.wantApplied {
+			t.Errorf("%s: Apply = %+v, %t, want %+v, %t", tt.name, got, applied, tt.want, tt.wantApplied)
+		}
+	}
+}
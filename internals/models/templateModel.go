@@ -16,4 +16,7 @@ type TemplateData struct {
 	Form            *forms.Form
 	IsAuthenticated bool
 	UserAccessLevel int
+
+	// * Typed view of the page, see views.go
+	View interface{}
 }
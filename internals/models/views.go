@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// * Typed views of the pages which are registered in render.views, their templates are checked when the template cache is built
+
+// SearchAvailabilityView: is the view of search-availability.page.tmpl, Reservation holds the last search and Suggestions what was found when nothing matched it
+type SearchAvailabilityView struct {
+	Reservation Reservation
+	Suggestions Suggestions
+}
+
+// FlexibleResultsView: is the view of flexible-results.page.tmpl, Options are cheapest first and Reservation holds the guests
+type FlexibleResultsView struct {
+	Reservation Reservation
+	From        time.Time
+	To          time.Time
+	Nights      int
+	Options     []StayOption
+}
+
+// ChooseRoomView: is the view of choose-room.page.tmpl, Reservation holds the searched dates and guests
+type ChooseRoomView struct {
+	Rooms       []Room
+	Reservation Reservation
+}
+
+// MakeReservationView: is the view of make-reservation.page.tmpl, HeldUntil is when the hold on the room ends, zero when there is none
+// * RatePlans are the ways the room can be booked, priced from Reservation.TotalPrice, the guest must pick one unless there are none
+// * DepositPercent of the total is held on the guest's card before the reservation is made
+type MakeReservationView struct {
+	Reservation    Reservation
+	HeldUntil      time.Time
+	RatePlans      []RatePlan
+	RatePlanID     int
+	DepositPercent int
+}
+
+// ReservationSummaryView: is the view of reservation-summary.page.tmpl, Deposit is what was held on the guest's card
+type ReservationSummaryView struct {
+	Reservation Reservation
+	Deposit     int
+}
+
+// BookingView: is the view of booking.page.tmpl, the booking a guest found with its confirmation code
+// * Rooms are those the guest can move to when CanChange, Change is the change they asked for waiting to be confirmed and has no ID when there is none
+// * Fee is what cancelling the booking today costs under the policy it was booked with, DepositDue is what more the change holds on the guest's card
+type BookingView struct {
+	Reservation Reservation
+	CanChange   bool
+	Rooms       []Room
+	Change      Reservation
+	Fee         int
+	DepositDue  int
+}
+
+// ExtraDue: returns how much more the change costs than the booking, 0 when it costs the same or less
+func (v BookingView) ExtraDue() int {
+	return max(0, v.Change.TotalPrice-v.Reservation.TotalPrice)
+}
+
+// Refund: returns how much less the change costs than the booking, 0 when it costs the same or more
+func (v BookingView) Refund() int {
+	return max(0, v.Reservation.TotalPrice-v.Change.TotalPrice)
+}
+
+// AdminAuditView: is the view of admin-audit.page.tmpl, From and To are the dates as typed in the filter form, To is inclusive
+type AdminAuditView struct {
+	Entries []AuditEntry
+	Filter  AuditFilter
+	From    string
+	To      string
+}
+
+// RoomsView: is the view of rooms.page.tmpl
+type RoomsView struct {
+	Rooms []Room
+}
+
+// RoomView: is the view of room.page.tmpl
+type RoomView struct {
+	Room Room
+}
+
+// AdminRoomsView: is the view of admin-rooms.page.tmpl
+type AdminRoomsView struct {
+	Rooms []Room
+}
+
+// AdminRoomView: is the view of admin-room.page.tmpl, Room.ID is 0 when a new room is being added
+// * Policies are those a new rate plan can use
+type AdminRoomView struct {
+	Room      Room
+	RatePlans []RatePlan
+	Policies  []CancellationPolicy
+}
+
+// AdminReservationView: is the view of admin-reservation.page.tmpl, Fee is what cancelling it today costs
+type AdminReservationView struct {
+	Reservation Reservation
+	Fee         int
+	Payments    []Payment
+}
+
+// AdminCancellationPoliciesView: is the view of admin-cancellation-policies.page.tmpl
+type AdminCancellationPoliciesView struct {
+	Policies []CancellationPolicy
+}
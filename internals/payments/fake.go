@@ -0,0 +1,182 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// * Payment methods the fake declines, Stripe's test payment methods for a declined card
+var declinedPaymentMethods = map[string]string{
+	"pm_card_chargeDeclined":                  "your card was declined",
+	"pm_card_chargeDeclinedInsufficientFunds": "your card has insufficient funds",
+	"pm_card_chargeDeclinedExpiredCard":       "your card has expired",
+}
+
+// * States of a payment held by the fake
+const (
+	fakeAuthorized = "authorized"
+	fakeCaptured   = "captured"
+	fakeVoided     = "voided"
+)
+
+// FakePayment: is a payment as the fake provider sees it
+type FakePayment struct {
+	ID       string
+	Status   string
+	Amount   int
+	Captured int
+	Refunded int
+}
+
+// Fake: is a PaymentGateway which keeps payments in memory, for development and tests
+// * Every payment method is accepted except Stripe's declined test ones, such as pm_card_chargeDeclined
+type Fake struct {
+	WebhookSecret string
+
+	mu          sync.Mutex
+	payments    map[string]*FakePayment
+	idempotency map[string]string
+	next        int
+}
+
+// NewFake: returns an empty fake provider whose webhooks are signed with webhookSecret
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{
+		WebhookSecret: webhookSecret,
+		payments:      map[string]*FakePayment{},
+		idempotency:   map[string]string{},
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Authorize: holds the amount unless the payment method is a declined one
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (Authorization, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// * A key is only answered again while its payment is still held, a payment since released or taken can't confirm another booking
+	// * Like Stripe, a key sent again with another amount is refused instead of answered with the first payment
+	if id, ok := f.idempotency[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		p := f.payments[id]
+		if p.Amount != req.Amount {
+			return Authorization{}, fmt.Errorf("%w: the idempotency key was used for payment %s of another amount", ErrRefused, id)
+		}
+		if p.Status != fakeAuthorized {
+			return Authorization{}, fmt.Errorf("%w: the idempotency key was used for payment %s which is %s", ErrRefused, id, p.Status)
+		}
+		return Authorization{ID: id, Amount: p.Amount}, nil
+	}
+
+	if req.Amount <= 0 {
+		return Authorization{}, fmt.Errorf("%w: the amount must be positive", ErrRefused)
+	}
+	if req.PaymentMethod == "" {
+		return Authorization{}, fmt.Errorf("%w: no payment method", ErrDeclined)
+	}
+	if reason, ok := declinedPaymentMethods[req.PaymentMethod]; ok {
+		return Authorization{}, fmt.Errorf("%w: %s", ErrDeclined, reason)
+	}
+
+	f.next++
+	id := "pi_fake_" + strconv.Itoa(f.next)
+	f.payments[id] = &FakePayment{ID: id, Status: fakeAuthorized, Amount: req.Amount}
+	if req.IdempotencyKey != "" {
+		f.idempotency[req.IdempotencyKey] = id
+	}
+
+	return Authorization{ID: id, Amount: req.Amount}, nil
+}
+
+// Capture: takes amount of an authorized payment and releases the rest
+func (f *Fake) Capture(ctx context.Context, id string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[id]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if p.Status != fakeAuthorized {
+		return fmt.Errorf("%w: payment %s is %s", ErrRefused, id, p.Status)
+	}
+	if amount <= 0 || amount > p.Amount {
+		return fmt.Errorf("%w: cannot capture %d of %d", ErrRefused, amount, p.Amount)
+	}
+
+	p.Status = fakeCaptured
+	p.Captured = amount
+
+	return nil
+}
+
+// Void: releases an authorized payment
+func (f *Fake) Void(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[id]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if p.Status != fakeAuthorized {
+		return fmt.Errorf("%w: payment %s is %s", ErrRefused, id, p.Status)
+	}
+
+	p.Status = fakeVoided
+
+	return nil
+}
+
+// Refund: gives back amount of a captured payment, a payment can be refunded in several parts
+func (f *Fake) Refund(ctx context.Context, id string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[id]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if p.Status != fakeCaptured {
+		return fmt.Errorf("%w: payment %s is %s", ErrRefused, id, p.Status)
+	}
+	if amount <= 0 || p.Refunded+amount > p.Captured {
+		return fmt.Errorf("%w: cannot refund %d of %d left", ErrRefused, amount, p.Captured-p.Refunded)
+	}
+
+	p.Refunded += amount
+
+	return nil
+}
+
+// VerifyWebhook: checks a webhook signed with the fake's secret, see Webhook
+func (f *Fake) VerifyWebhook(payload []byte, signature string) (Event, error) {
+	return verifyWebhook(f.WebhookSecret, payload, signature, time.Now())
+}
+
+// Payment: returns a payment held by the fake, false when there is none
+func (f *Fake) Payment(id string) (FakePayment, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[id]
+	if !ok {
+		return FakePayment{}, false
+	}
+	return *p, true
+}
+
+// Webhook: returns the payload and signature header of the webhook the provider would send about event, to post to the app by hand
+func (f *Fake) Webhook(event Event) ([]byte, string, error) {
+	payload, err := webhookPayload(event)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, SignWebhook(f.WebhookSecret, payload, time.Now()), nil
+}
@@ -0,0 +1,86 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeAuthorizeIdempotency(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("whsec_test")
+	req := AuthorizeRequest{Amount: 5000, Currency: "usd", PaymentMethod: "pm_card_visa", IdempotencyKey: "key"}
+
+	first, err := f.Authorize(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := f.Authorize(ctx, req)
+	if err != nil || again != first {
+		t.Fatalf("repeated key returned %+v, %v, want %+v", again, err, first)
+	}
+
+	// * Stripe refuses a key sent again with different parameters, the first payment stays held
+	changed := req
+	changed.Amount = 6000
+	if _, err := f.Authorize(ctx, changed); !errors.Is(err, ErrRefused) {
+		t.Errorf("key with another amount: expected ErrRefused, got %v", err)
+	}
+	if p := f.payments[first.ID]; p.Status != fakeAuthorized || p.Amount != 5000 {
+		t.Errorf("first payment is %+v after the refused request, want it held for 5000", p)
+	}
+
+	if err := f.Void(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Authorize(ctx, req); !errors.Is(err, ErrRefused) {
+		t.Errorf("key of a voided payment: expected ErrRefused, got %v", err)
+	}
+}
+
+func TestFakeAuthorizeDeclined(t *testing.T) {
+	f := NewFake("whsec_test")
+
+	for _, pm := range []string{"", "pm_card_chargeDeclined", "pm_card_chargeDeclinedExpiredCard"} {
+		_, err := f.Authorize(context.Background(), AuthorizeRequest{Amount: 5000, PaymentMethod: pm})
+		if !errors.Is(err, ErrDeclined) {
+			t.Errorf("payment method %q: expected ErrDeclined, got %v", pm, err)
+		}
+	}
+}
+
+func TestFakeCaptureAndRefund(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("whsec_test")
+
+	auth, err := f.Authorize(ctx, AuthorizeRequest{Amount: 5000, PaymentMethod: "pm_card_visa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Capture(ctx, auth.ID, 6000); !errors.Is(err, ErrRefused) {
+		t.Errorf("capture above the amount: expected ErrRefused, got %v", err)
+	}
+	if err := f.Capture(ctx, auth.ID, 3000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Void(ctx, auth.ID); !errors.Is(err, ErrRefused) {
+		t.Errorf("void after capture: expected ErrRefused, got %v", err)
+	}
+	if err := f.Refund(ctx, auth.ID, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Refund(ctx, auth.ID, 1001); !errors.Is(err, ErrRefused) {
+		t.Errorf("refund above what is left: expected ErrRefused, got %v", err)
+	}
+	if err := f.Capture(ctx, "pi_unknown", 1); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("unknown payment: expected ErrUnknownPayment, got %v", err)
+	}
+
+	p, _ := f.Payment(auth.ID)
+	if p.Status != fakeCaptured || p.Captured != 3000 || p.Refunded != 2000 {
+		t.Errorf("payment is %+v", p)
+	}
+}
@@ -0,0 +1,62 @@
+package payments
+
+// * Takes the money for reservations through a payment provider, handlers only see the PaymentGateway interface
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// * ErrDeclined is wrapped with the provider's reason when the guest's card is refused
+	ErrDeclined = errors.New("payment declined")
+	// * ErrRefused is wrapped with the provider's reason when a request doesn't fit the state of the payment, e.g. capturing it twice
+	ErrRefused          = errors.New("payment request refused")
+	ErrUnknownPayment   = errors.New("payment not found")
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+)
+
+// * Webhook events the app acts on, named like Stripe's
+const (
+	EventCaptured = "payment_intent.succeeded"
+	EventCanceled = "payment_intent.canceled"
+	EventFailed   = "payment_intent.payment_failed"
+	EventRefunded = "charge.refunded"
+)
+
+// AuthorizeRequest: asks to hold Amount in cents of Currency on the guest's PaymentMethod
+// * IdempotencyKey makes a retried request return the first authorization instead of holding the money twice
+type AuthorizeRequest struct {
+	Amount         int
+	Currency       string
+	PaymentMethod  string
+	Description    string
+	IdempotencyKey string
+}
+
+// Authorization: is money held on the guest's card, ID is the provider's reference to it
+type Authorization struct {
+	ID     string
+	Amount int
+}
+
+// Event: is a webhook from the provider about the payment PaymentID, Amount is what was captured or refunded in total
+type Event struct {
+	ID        string
+	Type      string
+	PaymentID string
+	Amount    int
+}
+
+// PaymentGateway: is a payment provider
+// * Authorize only holds the money, Capture takes up to the held amount and releases the rest, Void releases all of it
+type PaymentGateway interface {
+	// * Name is stored with every payment, so each is settled with the provider it was made with
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (Authorization, error)
+	Capture(ctx context.Context, id string, amount int) error
+	Void(ctx context.Context, id string) error
+	Refund(ctx context.Context, id string, amount int) error
+	// * VerifyWebhook checks the signature header sent with payload and returns the event it carries
+	VerifyWebhook(payload []byte, signature string) (Event, error)
+}
@@ -0,0 +1,157 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// * Longest a request to the provider may take, a guest is waiting for the answer
+const stripeTimeout = 15 * time.Second
+
+// Stripe: is a PaymentGateway using the Stripe API, or any server speaking it such as stripe-mock
+// * Money is authorized with a manually captured payment intent, confirmed when it is created
+type Stripe struct {
+	// * BaseURL is https://api.stripe.com in production, e.g. http://localhost:12111 for stripe-mock
+	BaseURL       string
+	SecretKey     string
+	WebhookSecret string
+	Client        *http.Client
+}
+
+// NewStripe: returns a Stripe adapter calling the API at baseURL
+func NewStripe(baseURL, secretKey, webhookSecret string) *Stripe {
+	return &Stripe{
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		Client:        &http.Client{Timeout: stripeTimeout},
+	}
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+// * stripeIntent is the part of a payment intent the app reads
+type stripeIntent struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Amount int    `json:"amount"`
+}
+
+// * stripeError is the body Stripe answers a failed request with
+type stripeError struct {
+	Error struct {
+		Type        string `json:"type"`
+		Code        string `json:"code"`
+		DeclineCode string `json:"decline_code"`
+		Message     string `json:"message"`
+	} `json:"error"`
+}
+
+// Authorize: creates and confirms a payment intent captured later, anything but requires_capture means the card was declined
+func (s *Stripe) Authorize(ctx context.Context, req AuthorizeRequest) (Authorization, error) {
+	form := url.Values{
+		"amount":                 {strconv.Itoa(req.Amount)},
+		"currency":               {req.Currency},
+		"payment_method":         {req.PaymentMethod},
+		"payment_method_types[]": {"card"},
+		"capture_method":         {"manual"},
+		"confirm":                {"true"},
+		"description":            {req.Description},
+	}
+
+	var intent stripeIntent
+	if err := s.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey, &intent); err != nil {
+		return Authorization{}, err
+	}
+
+	if intent.Status != "requires_capture" {
+		return Authorization{}, fmt.Errorf("%w: payment intent %s is %s", ErrDeclined, intent.ID, intent.Status)
+	}
+
+	return Authorization{ID: intent.ID, Amount: intent.Amount}, nil
+}
+
+// Capture: captures amount of the payment intent, Stripe releases the rest
+func (s *Stripe) Capture(ctx context.Context, id string, amount int) error {
+	form := url.Values{"amount_to_capture": {strconv.Itoa(amount)}}
+	return s.post(ctx, "/v1/payment_intents/"+url.PathEscape(id)+"/capture", form, "", nil)
+}
+
+// Void: cancels the payment intent, which releases the money held
+func (s *Stripe) Void(ctx context.Context, id string) error {
+	return s.post(ctx, "/v1/payment_intents/"+url.PathEscape(id)+"/cancel", url.Values{}, "", nil)
+}
+
+// Refund: refunds amount of the captured payment intent
+func (s *Stripe) Refund(ctx context.Context, id string, amount int) error {
+	form := url.Values{
+		"payment_intent": {id},
+		"amount":         {strconv.Itoa(amount)},
+	}
+	return s.post(ctx, "/v1/refunds", form, "", nil)
+}
+
+// VerifyWebhook: checks the Stripe-Signature header of a webhook
+func (s *Stripe) VerifyWebhook(payload []byte, signature string) (Event, error) {
+	return verifyWebhook(s.WebhookSecret, payload, signature, time.Now())
+}
+
+// post: sends a form encoded request to the API and decodes the answer into out when it isn't nil
+// * Card errors are returned as ErrDeclined, other refused requests as ErrRefused
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.SecretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("stripe %s: %w", path, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var e stripeError
+		_ = json.Unmarshal(body, &e)
+
+		switch {
+		case e.Error.Type == "card_error":
+			return fmt.Errorf("%w: %s", ErrDeclined, e.Error.Message)
+		case resp.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%w: %s", ErrUnknownPayment, e.Error.Message)
+		case resp.StatusCode < 500 && e.Error.Type == "invalid_request_error":
+			return fmt.Errorf("%w: %s", ErrRefused, e.Error.Message)
+		default:
+			return fmt.Errorf("stripe %s: status %d: %s", path, resp.StatusCode, e.Error.Message)
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("stripe %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// * Webhooks are signed the way Stripe signs them, a header "t=<unix time>,v1=<hex hmac-sha256 of t.payload>"
+
+// * Older signatures are refused, so a captured webhook can't be replayed later
+const webhookTolerance = 5 * time.Minute
+
+// SignWebhook: returns the signature header of payload sent at t
+func SignWebhook(secret string, payload []byte, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + webhookMAC(secret, timestamp, payload)
+}
+
+func webhookMAC(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhook: checks the signature header of payload against secret and returns the event in it
+func verifyWebhook(secret string, payload []byte, signature string, now time.Time) (Event, error) {
+	if secret == "" {
+		return Event{}, fmt.Errorf("%w: no webhook secret is set", ErrInvalidSignature)
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Event{}, ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return Event{}, fmt.Errorf("%w: signed too long ago", ErrInvalidSignature)
+	}
+
+	expected := webhookMAC(secret, timestamp, payload)
+	valid := false
+	for _, s := range signatures {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return Event{}, ErrInvalidSignature
+	}
+
+	return parseEvent(payload)
+}
+
+// * webhookEvent is the part of a Stripe event the app reads, the object is a payment intent or, for refunds, a charge
+type webhookEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID             string `json:"id"`
+			PaymentIntent  string `json:"payment_intent,omitempty"`
+			AmountReceived int    `json:"amount_received,omitempty"`
+			AmountRefunded int    `json:"amount_refunded,omitempty"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+func parseEvent(payload []byte) (Event, error) {
+	var e webhookEvent
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return Event{}, fmt.Errorf("cannot read webhook: %w", err)
+	}
+
+	object := e.Data.Object
+	event := Event{ID: e.ID, Type: e.Type, PaymentID: object.ID, Amount: object.AmountReceived}
+	if e.Type == EventRefunded {
+		event.PaymentID = object.PaymentIntent
+		event.Amount = object.AmountRefunded
+	}
+
+	return event, nil
+}
+
+// webhookPayload: returns the json of an event in the shape Stripe sends it
+func webhookPayload(event Event) ([]byte, error) {
+	var e webhookEvent
+	e.ID = event.ID
+	e.Type = event.Type
+	if event.Type == EventRefunded {
+		e.Data.Object.ID = "ch_" + strings.TrimPrefix(event.PaymentID, "pi_")
+		e.Data.Object.PaymentIntent = event.PaymentID
+		e.Data.Object.AmountRefunded = event.Amount
+	} else {
+		e.Data.Object.ID = event.PaymentID
+		e.Data.Object.AmountReceived = event.Amount
+	}
+
+	return json.Marshal(e)
+}
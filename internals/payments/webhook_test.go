@@ -0,0 +1,77 @@
+package payments
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := "whsec_test"
+	now := time.Date(2026, time.June, 1, 12, 0, 0, 0, time.UTC)
+	payload, err := webhookPayload(Event{ID: "evt_1", Type: EventCaptured, PaymentID: "pi_1", Amount: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		payload   []byte
+		signature string
+		wantErr   bool
+	}{
+		{"signed now", secret, payload, SignWebhook(secret, payload, now), false},
+		{"signed within the tolerance", secret, payload, SignWebhook(secret, payload, now.Add(-webhookTolerance)), false},
+		{"clock of the sender ahead", secret, payload, SignWebhook(secret, payload, now.Add(time.Minute)), false},
+		{"signed too long ago", secret, payload, SignWebhook(secret, payload, now.Add(-webhookTolerance-time.Second)), true},
+		{"signed too far ahead", secret, payload, SignWebhook(secret, payload, now.Add(webhookTolerance+time.Second)), true},
+		{"another secret", secret, payload, SignWebhook("whsec_other", payload, now), true},
+		{"payload changed", secret, append([]byte(" "), payload...), SignWebhook(secret, payload, now), true},
+		{"no secret set", "", payload, SignWebhook("", payload, now), true},
+		{"no signature", secret, payload, "", true},
+		{"no timestamp", secret, payload, "v1=" + webhookMAC(secret, strconv.FormatInt(now.Unix(), 10), payload), true},
+		{"one of several signatures matches", secret, payload, SignWebhook(secret, payload, now) + ",v1=deadbeef", false},
+	}
+
+	for _, tt := range tests {
+		event, err := verifyWebhook(tt.secret, tt.payload, tt.signature, now)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s: expected ErrInvalidSignature, got %v", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if event != (Event{ID: "evt_1", Type: EventCaptured, PaymentID: "pi_1", Amount: 5000}) {
+			t.Errorf("%s: got event %+v", tt.name, event)
+		}
+	}
+}
+
+func TestWebhookPayloadRoundTrip(t *testing.T) {
+	events := []Event{
+		{ID: "evt_1", Type: EventCaptured, PaymentID: "pi_1", Amount: 5000},
+		{ID: "evt_2", Type: EventCanceled, PaymentID: "pi_1"},
+		{ID: "evt_3", Type: EventRefunded, PaymentID: "pi_1", Amount: 2000},
+	}
+
+	for _, want := range events {
+		payload, err := webhookPayload(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseEvent(payload)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", want.Type, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: parsed %+v, want %+v", want.Type, got, want)
+		}
+	}
+}
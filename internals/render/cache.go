@@ -0,0 +1,140 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// * templateCache is swapped as a whole so a request never sees a half built cache
+type templateCache struct {
+	templates map[string]*template.Template
+	// * err is the last failed rebuild, templates then still holds the previous good cache
+	err error
+}
+
+var cache atomic.Pointer[templateCache]
+
+// LoadTemplates: builds the template cache and makes it current, when the build fails the previous cache stays in use and the error is kept for the developer overlay
+func LoadTemplates() error {
+	tc, err := CreateTemplateCache()
+
+	next := &templateCache{templates: tc, err: err}
+	if err != nil {
+		next.templates = nil
+		if previous := cache.Load(); previous != nil {
+			next.templates = previous.templates
+		}
+	}
+
+	cache.Store(next)
+	return err
+}
+
+// CacheStatus: returns how many pages are cached and the error of the last build, if it failed
+func CacheStatus() (int, error) {
+	current := cache.Load()
+	if current == nil {
+		return 0, nil
+	}
+	return len(current.templates), current.err
+}
+
+// WatchTemplates: rebuilds the template cache whenever a template changes, it polls every interval until ctx is cancelled
+func WatchTemplates(ctx context.Context, interval time.Duration) {
+	last, err := fingerprint(App.Templates)
+	if err != nil {
+		App.Logger.Error("cannot watch templates", "error", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := fingerprint(App.Templates)
+		if err != nil {
+			App.Logger.Error("cannot watch templates", "error", err)
+			continue
+		}
+
+		if current == last {
+			continue
+		}
+		last = current
+
+		if err := LoadTemplates(); err != nil {
+			App.Logger.Error("cannot rebuild template cache", "error", err)
+			continue
+		}
+		App.Logger.Info("template cache rebuilt")
+	}
+}
+
+// fingerprint: summarises the name, size and modification time of every file in fsys
+func fingerprint(fsys fs.FS) (string, error) {
+	var entries []string
+
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, fmt.Sprintf("%s|%d|%d", path, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(entries)
+	return strings.Join(entries, "\n"), nil
+}
+
+var devErrorTemplate = template.Must(template.New("dev-error").Parse(`<!doctype html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>Template error</title>
+    <style>
+        body { margin: 0; font-family: -apple-system, "Segoe UI", Roboto, sans-serif; background: #1e1e1e; color: #eee; }
+        .overlay { max-width: 960px; margin: 4em auto; padding: 2em; border-top: 6px solid #e53e3e; background: #2d2d2d; }
+        h1 { margin-top: 0; color: #fc8181; font-size: 1.4em; }
+        pre { white-space: pre-wrap; word-break: break-word; font-size: 1em; line-height: 1.5; }
+        p { color: #aaa; }
+    </style>
+</head>
+<body>
+<div class="overlay">
+    <h1>Templates failed to build</h1>
+    <pre>{{.}}</pre>
+    <p>The page reloads with the last good templates once the error is fixed and saved. This overlay is only shown in development.</p>
+</div>
+</body>
+</html>`))
+
+// devErrorOverlay: writes the template build error as a full page, only used in development
+func devErrorOverlay(w http.ResponseWriter, buildErr error) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	return devErrorTemplate.Execute(w, buildErr.Error())
+}
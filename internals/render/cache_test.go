@@ -0,0 +1,101 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// templateDir: points the renderer at a temporary directory holding the given files and returns that directory
+func templateDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTemplates(t, dir, files)
+	App.Templates = os.DirFS(dir)
+
+	return dir
+}
+
+func writeTemplates(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadTemplatesKeepsLastGoodCache(t *testing.T) {
+	newTestApp()
+	cache.Store(nil)
+	dir := templateDir(t, map[string]string{"a.page.tmpl": `a`})
+
+	if err := LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := CacheStatus(); n != 1 || err != nil {
+		t.Fatalf("after a good build status is (%d, %v), want (1, nil)", n, err)
+	}
+
+	writeTemplates(t, dir, map[string]string{"b.page.tmpl": `{{if}}`})
+	if err := LoadTemplates(); err == nil {
+		t.Fatal("broken template built without error")
+	}
+	n, err := CacheStatus()
+	if n != 1 || err == nil {
+		t.Fatalf("after a failed build status is (%d, %v), want the previous page and the error", n, err)
+	}
+	if cache.Load().templates["a.page.tmpl"] == nil {
+		t.Error("previous templates were dropped by the failed build")
+	}
+
+	writeTemplates(t, dir, map[string]string{"b.page.tmpl": `b`})
+	if err := LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := CacheStatus(); n != 2 || err != nil {
+		t.Errorf("after the fix status is (%d, %v), want (2, nil)", n, err)
+	}
+}
+
+func TestWatchTemplatesRebuildsOnChange(t *testing.T) {
+	newTestApp()
+	cache.Store(nil)
+	dir := templateDir(t, map[string]string{"a.page.tmpl": `a`})
+	if err := LoadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchTemplates(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	// * Give the watcher time to take its first fingerprint before changing the directory
+	time.Sleep(20 * time.Millisecond)
+	writeTemplates(t, dir, map[string]string{"b.page.tmpl": `b`})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if n, _ := CacheStatus(); n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("template cache was not rebuilt after a new page was added")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("watcher did not stop when its context was cancelled")
+	}
+}
@@ -0,0 +1,155 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// * functions are available in every template
+var functions = template.FuncMap{
+	"humanDate":  HumanDate,
+	"formatDate": FormatDate,
+	"currency":   Currency,
+	"dollars":    Dollars,
+	"pluralize":  Pluralize,
+	"url":        URL,
+	"dict":       Dict,
+	"seq":        Seq,
+	"join":       strings.Join,
+	"add":        Add,
+	"weekdays":   Weekdays,
+}
+
+// HumanDate: formats t as YYYY-MM-DD, the format used across the site
+func HumanDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// FormatDate: formats t with a go time layout
+func FormatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// Currency: formats an amount in cents as dollars, e.g. 123456 -> $1,234.56
+func Currency(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	dollars := strconv.Itoa(cents / 100)
+
+	// * Group the dollars in thousands
+	var grouped strings.Builder
+	for i, digit := range dollars {
+		if i > 0 && (len(dollars)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return fmt.Sprintf("%s$%s.%02d", sign, grouped.String(), cents%100)
+}
+
+// Dollars: formats an amount in cents for a form input, e.g. 9550 -> 95.50
+func Dollars(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Pluralize: returns singular when n is 1 and plural otherwise
+func Pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// URL: builds a path with query params from key value pairs, e.g. url "/book-room" "id" 1 "s" "2024-01-01"
+func URL(path string, pairs ...interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("url expects key value pairs")
+	}
+
+	query := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return "", fmt.Errorf("url key %v is not a string", pairs[i])
+		}
+
+		value := pairs[i+1]
+		if t, ok := value.(time.Time); ok {
+			value = HumanDate(t)
+		}
+		query.Add(key, fmt.Sprint(value))
+	}
+
+	if len(query) == 0 {
+		return path, nil
+	}
+
+	return path + "?" + query.Encode(), nil
+}
+
+// Dict: builds a map from key value pairs, used to pass several values to a sub template
+func Dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict expects key value pairs")
+	}
+
+	dict := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", pairs[i])
+		}
+		dict[key] = pairs[i+1]
+	}
+
+	return dict, nil
+}
+
+// Add: returns a + b, e.g. to compare a zero based index with a length
+func Add(a, b int) int {
+	return a + b
+}
+
+// Seq: returns the integers from start to end inclusive, for ranging a fixed number of times
+func Seq(start, end int) []int {
+	if end < start {
+		return []int{}
+	}
+
+	seq := make([]int, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		seq = append(seq, i)
+	}
+	return seq
+}
+
+// Weekdays: returns the days of the week from Sunday to Saturday
+func Weekdays() []time.Weekday {
+	days := make([]time.Weekday, 0, 7)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		days = append(days, day)
+	}
+	return days
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCurrency(t *testing.T) {
+	tests := []struct {
+		cents int
+		want  string
+	}{
+		{0, "$0.00"},
+		{5, "$0.05"},
+		{99, "$0.99"},
+		{100, "$1.00"},
+		{9550, "$95.50"},
+		{100000, "$1,000.00"},
+		{123456, "$1,234.56"},
+		{123456789, "$1,234,567.89"},
+		{-123456, "-$1,234.56"},
+	}
+
+	for _, tt := range tests {
+		if got := Currency(tt.cents); got != tt.want {
+			t.Errorf("Currency(%d) = %q, want %q", tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestDollars(t *testing.T) {
+	tests := []struct {
+		cents int
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{9550, "95.50"},
+		{123456, "1234.56"},
+		{-5, "-0.05"},
+		{-150, "-1.50"},
+	}
+
+	for _, tt := range tests {
+		if got := Dollars(tt.cents); got != tt.want {
+			t.Errorf("Dollars(%d) = %q, want %q", tt.cents, got, tt.want)
+		}
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "nights"},
+		{1, "night"},
+		{2, "nights"},
+		{-1, "nights"},
+	}
+
+	for _, tt := range tests {
+		if got := Pluralize(tt.n, "night", "nights"); got != tt.want {
+			t.Errorf("Pluralize(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestWeekdays(t *testing.T) {
+	days := Weekdays()
+	if len(days) != 7 || days[0] != time.Sunday || days[6] != time.Saturday {
+		t.Errorf("Weekdays() = %v, want Sunday to Saturday", days)
+	}
+}
+
+func TestURL(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		pairs   []interface{}
+		want    string
+		wantErr bool
+	}{
+		{nil, "/book-room", false},
+		{[]interface{}{"id", 1, "s", start}, "/book-room?id=1&s=2026-03-02", false},
+		{[]interface{}{"q", "a b&c"}, "/book-room?q=a+b%26c", false},
+		{[]interface{}{"id"}, "", true},
+		{[]interface{}{1, "id"}, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := URL("/book-room", tt.pairs...)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("URL(%v) = %q, %v, want %q", tt.pairs, got, err, tt.want)
+		}
+	}
+}
@@ -2,13 +2,16 @@ package render
 
 import (
 	"bytes"
-	"log"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
 	"net/http"
-	"path/filepath"
-	"text/template"
+	"path"
 
 	"github.com/imrcht/bed-n-breakfast/internals/config"
 	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
 	"github.com/justinas/nosurf"
 )
@@ -31,29 +34,26 @@ func defaultTempData(td *models.TemplateData, r *http.Request) *models.TemplateD
 	return td
 }
 
-func Template(w http.ResponseWriter, r *http.Request, temp string, td *models.TemplateData) {
+// Template: renders the page into a buffer and writes it only if it executed completely, errors are returned so the caller can send a 500
+func Template(w http.ResponseWriter, r *http.Request, temp string, td *models.TemplateData) error {
 
-	var tc map[string]*template.Template
-
-	if App.UseCache {
-		// * Get the template cache from app config
-		tc = App.TemplateCache
-	} else {
+	current := cache.Load()
+	if current == nil {
+		return errors.New("template cache is not loaded")
+	}
 
-		// * Create template cache and store
-		newTc, errInCreatingTc := CreateTemplateCache()
-		if errInCreatingTc != nil {
-			helpers.ServerError(w, errInCreatingTc)
-			return
-		}
-		tc = newTc
+	// * In development a failed rebuild is shown to the developer instead of the stale page
+	if current.err != nil && !App.InProduction {
+		return devErrorOverlay(w, current.err)
 	}
 
+	tc := current.templates
+
 	// * Get requested template from cache
 	t, ok := tc[temp]
 
 	if !ok {
-		log.Fatal("Could not get template from template cache")
+		return fmt.Errorf("template %s is not in the template cache", temp)
 	}
 
 	buf := new(bytes.Buffer)
@@ -62,15 +62,18 @@ func Template(w http.ResponseWriter, r *http.Request, temp string, td *models.Te
 
 	err := t.Execute(buf, td)
 	if err != nil {
-		log.Println(err)
+		return fmt.Errorf("cannot execute template %s: %w", temp, err)
 	}
 
 	// * Render template to response writer
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Println(err)
+		// * The client has gone away, the response can't be replaced with an error page anymore
+		logging.FromContext(r.Context(), App.Logger).Error("cannot write template", "template", temp, "error", err)
 	}
 
+	return nil
+
 	// * Old approach
 	/* parsedFile, _ := template.ParseFiles("./templates/"+temp, "./templates/base.layout.tmpl")
 	err := parsedFile.Execute(w, nil)
@@ -86,32 +89,36 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 	myCache := map[string]*template.Template{}
 
 	// * Get all pages of templates starting with *.page.tmpl;
-	pages, err := filepath.Glob("./templates/*.page.tmpl")
+	pages, err := fs.Glob(App.Templates, "*.page.tmpl")
 
 	if err != nil {
 		return myCache, err
 	}
 
 	for _, page := range pages {
-		t := filepath.Base(page)
+		t := path.Base(page)
 
-		ts, err := template.New(t).ParseFiles(page)
+		ts, err := template.New(t).Funcs(functions).ParseFS(App.Templates, page)
 		if err != nil {
 			return myCache, err
 		}
 
-		matches, err := filepath.Glob("./templates/*.layout.tmpl")
+		matches, err := fs.Glob(App.Templates, "*.layout.tmpl")
 		if err != nil {
 			return myCache, err
 		}
 
 		if len(matches) > 0 {
-			ts, err = ts.ParseGlob("./templates/*.layout.tmpl")
+			ts, err = ts.ParseFS(App.Templates, "*.layout.tmpl")
 			if err != nil {
 				return myCache, err
 			}
 		}
 
+		if err = checkView(t, ts); err != nil {
+			return myCache, err
+		}
+
 		myCache[t] = ts
 	}
 
@@ -0,0 +1,98 @@
+package render
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/helpers"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+// newTestApp: sets up the renderer with a fresh session manager and a logger writing nowhere
+func newTestApp() *config.AppConfig {
+	app := &config.AppConfig{
+		Logger:  logging.New(io.Discard, false),
+		Session: scs.New(),
+	}
+	NewRenderer(app)
+	helpers.NewHelpers(app)
+
+	return app
+}
+
+// newRequest: returns a request with a loaded session, as the session middleware would
+func newRequest(t *testing.T) *http.Request {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx, err := App.Session.Load(r.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestTemplate(t *testing.T) {
+	newTestApp()
+	cache.Store(&templateCache{templates: map[string]*template.Template{
+		"ok.page.tmpl":     template.Must(template.New("ok.page.tmpl").Parse(`<p>{{index .StringMap "name"}}</p>`)),
+		"broken.page.tmpl": template.Must(template.New("broken.page.tmpl").Parse(`<p>before</p>{{.Missing}}`)),
+	}})
+
+	tests := []struct {
+		name     string
+		page     string
+		wantErr  bool
+		wantBody string
+	}{
+		{name: "renders the page", page: "ok.page.tmpl", wantBody: "<p>&lt;b&gt;</p>"},
+		{name: "page not in the cache", page: "missing.page.tmpl", wantErr: true},
+		{name: "page failing halfway writes nothing", page: "broken.page.tmpl", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		err := Template(rr, newRequest(t), tt.page, &models.TemplateData{StringMap: map[string]string{"name": "<b>"}})
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error is %v", tt.name, err)
+		}
+		if rr.Body.String() != tt.wantBody {
+			t.Errorf("%s: body is %q, want %q", tt.name, rr.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestTemplateShowsBuildErrorInDevelopment(t *testing.T) {
+	app := newTestApp()
+	cache.Store(&templateCache{
+		templates: map[string]*template.Template{"ok.page.tmpl": template.Must(template.New("ok.page.tmpl").Parse(`old page`))},
+		err:       errors.New("home.page.tmpl: unexpected EOF"),
+	})
+
+	rr := httptest.NewRecorder()
+	if err := Template(rr, newRequest(t), "ok.page.tmpl", &models.TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "unexpected EOF") {
+		t.Errorf("development got %d %q, want the error overlay", rr.Code, rr.Body.String())
+	}
+
+	// * Production keeps serving the last good templates
+	app.InProduction = true
+	rr = httptest.NewRecorder()
+	if err := Template(rr, newRequest(t), "ok.page.tmpl", &models.TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != "old page" {
+		t.Errorf("production got %q, want the last good page", rr.Body.String())
+	}
+}
@@ -0,0 +1,109 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/forms"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+// * views maps a page to the typed view it is rendered with
+var views = map[string]interface{}{
+	"search-availability.page.tmpl":         models.SearchAvailabilityView{},
+	"flexible-results.page.tmpl":            models.FlexibleResultsView{},
+	"admin-audit.page.tmpl":                 models.AdminAuditView{},
+	"choose-room.page.tmpl":                 models.ChooseRoomView{},
+	"make-reservation.page.tmpl":            models.MakeReservationView{},
+	"reservation-summary.page.tmpl":         models.ReservationSummaryView{},
+	"booking.page.tmpl":                     models.BookingView{},
+	"rooms.page.tmpl":                       models.RoomsView{},
+	"room.page.tmpl":                        models.RoomView{},
+	"admin-rooms.page.tmpl":                 models.AdminRoomsView{},
+	"admin-room.page.tmpl":                  models.AdminRoomView{},
+	"admin-reservation.page.tmpl":           models.AdminReservationView{},
+	"admin-cancellation-policies.page.tmpl": models.AdminCancellationPoliciesView{},
+}
+
+// * Date every time of a sample view is set to
+var sampleDate = time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+// checkView: executes a page against the zero value of its view and against a sample of it, so a misspelt field fails when the cache is built instead of rendering an empty string
+// * The zero value skips what is inside ranges, withs and ifs, the sample fills every slice, bool and number so those are executed too
+func checkView(name string, t *template.Template) error {
+	view, ok := views[name]
+	if !ok {
+		return nil
+	}
+
+	for _, v := range []interface{}{view, sampleView(reflect.TypeOf(view), nil).Interface()} {
+		td := &models.TemplateData{
+			StringMap: map[string]string{},
+			IntMap:    map[string]int{},
+			FloatMap:  map[string]float32{},
+			BoolMap:   map[string]bool{},
+			Data:      map[string]interface{}{},
+			View:      v,
+			Form:      forms.New(nil),
+		}
+
+		if err := t.Execute(io.Discard, td); err != nil {
+			return fmt.Errorf("template %s does not match its view %T: %w", name, view, err)
+		}
+	}
+
+	return nil
+}
+
+// sampleView: returns a value of type t with every field set, slices and maps with one element, bools true, numbers 1, strings "x" and times sampleDate
+// * Unexported fields are left zero, a type already being filled in the types above it is left zero too so recursive types end
+func sampleView(t reflect.Type, filling []reflect.Type) reflect.Value {
+	v := reflect.New(t).Elem()
+	if t == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(sampleDate))
+		return v
+	}
+	for _, f := range filling {
+		if f == t {
+			return v
+		}
+	}
+	filling = append(filling, t)
+
+	switch t.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Pointer:
+		p := reflect.New(t.Elem())
+		p.Elem().Set(sampleView(t.Elem(), filling))
+		v.Set(p)
+	case reflect.Slice:
+		v.Set(reflect.Append(reflect.MakeSlice(t, 0, 1), sampleView(t.Elem(), filling)))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).Set(sampleView(t.Elem(), filling))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		v.SetMapIndex(sampleView(t.Key(), filling), sampleView(t.Elem(), filling))
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				v.Field(i).Set(sampleView(t.Field(i).Type, filling))
+			}
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSampleView(t *testing.T) {
+	type node struct {
+		Name     string
+		Children []node
+		Parent   *node
+	}
+	type view struct {
+		Count   int
+		Price   float64
+		Shown   bool
+		Date    time.Time
+		Names   []string
+		Ages    map[string]int
+		Pointer *int
+		Tree    node
+		hidden  string
+	}
+
+	v := sampleView(reflect.TypeOf(view{}), nil).Interface().(view)
+
+	if v.Count != 1 || v.Price != 1 || !v.Shown {
+		t.Errorf("numbers and bools are %d, %g, %t", v.Count, v.Price, v.Shown)
+	}
+	if !v.Date.Equal(sampleDate) {
+		t.Errorf("date is %s", v.Date)
+	}
+	if len(v.Names) != 1 || v.Names[0] != "x" {
+		t.Errorf("names are %v", v.Names)
+	}
+	if v.Ages["x"] != 1 {
+		t.Errorf("ages are %v", v.Ages)
+	}
+	if v.Pointer == nil || *v.Pointer != 1 {
+		t.Errorf("pointer is %v", v.Pointer)
+	}
+	if v.hidden != "" {
+		t.Errorf("unexported field set to %q", v.hidden)
+	}
+
+	// * A recursive type is filled one level deep
+	if v.Tree.Name != "x" || len(v.Tree.Children) != 1 || v.Tree.Parent == nil {
+		t.Errorf("tree is %+v", v.Tree)
+	}
+	if v.Tree.Children[0].Children != nil || v.Tree.Parent.Parent != nil {
+		t.Errorf("recursion went deeper than one level: %+v", v.Tree)
+	}
+}
@@ -0,0 +1,207 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+// * Audit actions and entities written to audit_logs
+const (
+	auditActionInsert      = "insert"
+	auditActionUpdate      = "update"
+	auditActionCancel      = "cancel"
+	auditActionDelete      = "delete"
+	auditActionLogin       = "login"
+	auditActionLoginFailed = "login_failed"
+
+	auditEntityReservation     = "reservation"
+	auditEntityRoomRestriction = "room_restriction"
+	auditEntityUser            = "user"
+)
+
+// * Fields which are never written to the audit diff
+var auditSkipFields = map[string]bool{
+	"Password":  true,
+	"CreatedAt": true,
+	"UpdatedAt": true,
+}
+
+// * execer is satisfied by both *sql.DB and *sql.Tx so audit entries can be written inside the caller's transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// auditFields: flattens a model into its json fields, nil gives an empty map
+func auditFields(v interface{}) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if v == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for field := range auditSkipFields {
+		delete(fields, field)
+	}
+
+	return fields, nil
+}
+
+// auditDiff: returns a json object of every field that differs between before and after, as {"Field": {"before": x, "after": y}}
+func auditDiff(before, after interface{}) (string, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return "", err
+	}
+
+	a, err := auditFields(after)
+	if err != nil {
+		return "", err
+	}
+
+	diff := map[string]map[string]json.RawMessage{}
+
+	for field, value := range a {
+		if old, ok := b[field]; ok && string(old) == string(value) {
+			continue
+		}
+		diff[field] = map[string]json.RawMessage{"before": nullIfEmpty(b[field]), "after": value}
+	}
+
+	for field, value := range b {
+		if _, ok := a[field]; !ok {
+			diff[field] = map[string]json.RawMessage{"before": value, "after": json.RawMessage("null")}
+		}
+	}
+
+	out, err := json.Marshal(diff)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+func nullIfEmpty(v json.RawMessage) json.RawMessage {
+	if len(v) == 0 {
+		return json.RawMessage("null")
+	}
+	return v
+}
+
+// insertAudit: appends an audit entry using db, which should be the transaction that made the change
+func (m *postgressDBRepo) insertAudit(ctx context.Context, db execer, actor models.Actor, action, entity string, entityId int, before, after interface{}) error {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	var actorId, entityIdValue sql.NullInt64
+	if actor.UserID > 0 {
+		actorId = sql.NullInt64{Int64: int64(actor.UserID), Valid: true}
+	}
+	if entityId > 0 {
+		entityIdValue = sql.NullInt64{Int64: int64(entityId), Valid: true}
+	}
+
+	query := `insert into audit_logs (actor_id, actor_email, ip, action, entity, entity_id, changes, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = db.ExecContext(ctx, query,
+		actorId,
+		actor.Email,
+		actor.IP,
+		action,
+		entity,
+		entityIdValue,
+		changes,
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
+}
+
+// AllAuditEntries: returns audit entries matching the filter, newest first
+func (m *postgressDBRepo) AllAuditEntries(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "AllAuditEntries")
+
+	var conditions []string
+	var args []interface{}
+
+	// * Build the where clause from whichever filters were set
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Entity != "" {
+		addCondition("entity = $%d", filter.Entity)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if filter.Actor != "" {
+		addCondition("actor_email ilike $%d", "%"+filter.Actor+"%")
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := `select id, coalesce(actor_id, 0), actor_email, ip, action, entity, coalesce(entity_id, 0), changes, created_at from audit_logs`
+	if len(conditions) > 0 {
+		query += " where " + strings.Join(conditions, " and ")
+	}
+	query += fmt.Sprintf(" order by created_at desc, id desc limit %d", limit)
+
+	var entries []models.AuditEntry
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		m.logError(ctx, "AllAuditEntries", err)
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEntry
+		err = rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.IP, &e.Action, &e.Entity, &e.EntityID, &e.Changes, &e.CreatedAt)
+		if err != nil {
+			m.logError(ctx, "AllAuditEntries", err)
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "AllAuditEntries", err)
+		return entries, err
+	}
+
+	return entries, nil
+}
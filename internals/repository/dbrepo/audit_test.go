@@ -0,0 +1,71 @@
+package dbrepo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditDiff(t *testing.T) {
+	type item struct {
+		Name      string
+		Price     int
+		Tags      []string
+		Password  string
+		UpdatedAt time.Time
+	}
+
+	before := item{Name: "Suite", Price: 100, Tags: []string{"sea"}, Password: "old", UpdatedAt: time.Unix(0, 0)}
+
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   string
+	}{
+		{
+			name:  "insert",
+			after: item{Name: "Suite", Price: 100},
+			want:  `{"Name":{"after":"Suite","before":null},"Price":{"after":100,"before":null},"Tags":{"after":null,"before":null}}`,
+		},
+		{
+			name:   "update of one field",
+			before: before,
+			after:  item{Name: "Suite", Price: 120, Tags: []string{"sea"}, Password: "new", UpdatedAt: time.Now()},
+			want:   `{"Price":{"after":120,"before":100}}`,
+		},
+		{
+			name:   "update of a list",
+			before: before,
+			after:  item{Name: "Suite", Price: 100, Tags: []string{"sea", "view"}},
+			want:   `{"Tags":{"after":["sea","view"],"before":["sea"]}}`,
+		},
+		{
+			name:   "nothing changed but skipped fields",
+			before: before,
+			after:  item{Name: "Suite", Price: 100, Tags: []string{"sea"}, Password: "new"},
+			want:   `{}`,
+		},
+		{
+			name:   "delete",
+			before: before,
+			want:   `{"Name":{"after":null,"before":"Suite"},"Price":{"after":null,"before":100},"Tags":{"after":null,"before":["sea"]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := auditDiff(tt.before, tt.after)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuditDiffOfUnencodableValue(t *testing.T) {
+	if _, err := auditDiff(nil, map[string]interface{}{"f": func() {}}); err == nil {
+		t.Error("expected an error for a value json can't encode")
+	}
+}
@@ -1,12 +1,18 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
 	"github.com/imrcht/bed-n-breakfast/internals/repository"
 )
 
+// * Used when AppConfig.DBQueryTimeout is not set
+const defaultQueryTimeout = 3 * time.Second
+
 type postgressDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -18,3 +24,18 @@ func NewPostgressDBRepo(a *config.AppConfig, conn *sql.DB) repository.DatabaseRe
 		DB:  conn,
 	}
 }
+
+// logError: logs a failed query with the logger of the request that made it
+func (m *postgressDBRepo) logError(ctx context.Context, method string, err error) {
+	logging.FromContext(ctx, m.App.Logger).Error("database query failed", "method", method, "error", err)
+}
+
+// queryContext: derives the context of one repository call from ctx, so it ends when the request is cancelled or the query timeout passes
+func (m *postgressDBRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := m.App.DBQueryTimeout
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
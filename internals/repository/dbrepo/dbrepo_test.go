@@ -0,0 +1,49 @@
+package dbrepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+)
+
+func TestQueryContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name          string
+		timeout       time.Duration
+		parent        context.Context
+		wantTimeout   time.Duration
+		wantCancelled bool
+	}{
+		{name: "default timeout", parent: context.Background(), wantTimeout: defaultQueryTimeout},
+		{name: "configured timeout", timeout: 250 * time.Millisecond, parent: context.Background(), wantTimeout: 250 * time.Millisecond},
+		{name: "negative timeout uses default", timeout: -time.Second, parent: context.Background(), wantTimeout: defaultQueryTimeout},
+		{name: "cancelled request", timeout: time.Minute, parent: cancelled, wantTimeout: time.Minute, wantCancelled: true},
+	}
+
+	for _, tt := range tests {
+		m := &postgressDBRepo{App: &config.AppConfig{DBQueryTimeout: tt.timeout}}
+
+		ctx, cancel := m.queryContext(tt.parent)
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Errorf("%s: query context has no deadline", tt.name)
+		} else if got := time.Until(deadline); got > tt.wantTimeout || got < tt.wantTimeout-time.Second/10 {
+			t.Errorf("%s: deadline is %v away, want %v", tt.name, got, tt.wantTimeout)
+		}
+
+		if (ctx.Err() != nil) != tt.wantCancelled {
+			t.Errorf("%s: context error is %v, want cancelled %v", tt.name, ctx.Err(), tt.wantCancelled)
+		}
+
+		cancel()
+		if ctx.Err() == nil {
+			t.Errorf("%s: cancel did not end the query context", tt.name)
+		}
+	}
+}
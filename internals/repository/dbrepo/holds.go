@@ -0,0 +1,136 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+// * Holds are short lived and replaced often, so unlike restrictions they are not recorded in the audit log
+
+// heldFrom: returns the date a hold must end after to collide with a stay arriving on start, as a held stay is followed by its cleaning block too
+func (m *postgressDBRepo) heldFrom(start_date time.Time) time.Time {
+	return start_date.AddDate(0, 0, -m.cleaningDays())
+}
+
+// HoldRoom: holds a room from start to end for the holder until hold.ExpiresAt, replacing the holder's earlier holds
+// * Returns repository.ErrRoomUnavailable when the dates are booked or held by someone else
+func (m *postgressDBRepo) HoldRoom(ctx context.Context, hold models.RoomHold) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "HoldRoom")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "HoldRoom", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// * Locking the room makes two guests holding the same dates at once wait for each other
+	var roomId int
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 and active for update`, hold.RoomID).Scan(&roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrRoomUnavailable
+	}
+	if err != nil {
+		m.logError(ctx, "HoldRoom", err)
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_holds where holder = $1`, hold.Holder)
+	if err != nil {
+		m.logError(ctx, "HoldRoom", err)
+		return 0, err
+	}
+
+	var free bool
+	query := `select not exists(select 1 from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date)
+	and not exists(select 1 from room_holds where room_id = $1 and expires_at > $4 and $5 < end_date and $3 > start_date)`
+	err = tx.QueryRowContext(ctx, query, hold.RoomID, hold.StartDate, m.blockedUntil(hold.EndDate), time.Now(), m.heldFrom(hold.StartDate)).Scan(&free)
+	if err != nil {
+		m.logError(ctx, "HoldRoom", err)
+		return 0, err
+	}
+	if !free {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	query = `insert into room_holds (room_id, start_date, end_date, holder, expires_at, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	err = tx.QueryRowContext(ctx, query, hold.RoomID, hold.StartDate, hold.EndDate, hold.Holder, hold.ExpiresAt, time.Now(), time.Now()).Scan(&hold.ID)
+	if err != nil {
+		m.logError(ctx, "HoldRoom", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "HoldRoom", err)
+		return 0, err
+	}
+
+	return hold.ID, nil
+}
+
+// DeleteExpiredHolds: deletes the holds which have expired and returns how many there were
+// * Expired holds are already ignored by availability, deleting them only keeps the table small
+func (m *postgressDBRepo) DeleteExpiredHolds(ctx context.Context) (int64, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "DeleteExpiredHolds")
+
+	result, err := m.DB.ExecContext(ctx, `delete from room_holds where expires_at <= $1`, time.Now())
+	if err != nil {
+		m.logError(ctx, "DeleteExpiredHolds", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// RoomHoldsBetween: returns the active holds of other holders overlapping from to to, of one room or of every room when roomId is 0
+func (m *postgressDBRepo) RoomHoldsBetween(ctx context.Context, roomId int, from, to time.Time, holder string) ([]models.RoomHold, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "RoomHoldsBetween")
+
+	query := `select id, room_id, start_date, end_date, holder, expires_at, created_at, updated_at
+	from room_holds where holder <> $1 and expires_at > $2 and $3 < end_date and $4 > start_date`
+	args := []interface{}{holder, time.Now(), from, to}
+	if roomId > 0 {
+		query += ` and room_id = $5`
+		args = append(args, roomId)
+	}
+	query += ` order by room_id, start_date`
+
+	var holds []models.RoomHold
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		m.logError(ctx, "RoomHoldsBetween", err)
+		return holds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h models.RoomHold
+		err = rows.Scan(&h.ID, &h.RoomID, &h.StartDate, &h.EndDate, &h.Holder, &h.ExpiresAt, &h.CreatedAt, &h.UpdatedAt)
+		if err != nil {
+			m.logError(ctx, "RoomHoldsBetween", err)
+			return holds, err
+		}
+		holds = append(holds, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "RoomHoldsBetween", err)
+		return holds, err
+	}
+
+	return holds, nil
+}
@@ -0,0 +1,187 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+const (
+	auditEntityPayment = "payment"
+
+	paymentColumns = `id, reservation_id, provider, reference, status, amount, captured_amount, refunded_amount, currency, created_at, updated_at`
+)
+
+func scanPayment(row scanner) (models.Payment, error) {
+	var p models.Payment
+
+	err := row.Scan(&p.ID, &p.ReservationID, &p.Provider, &p.Reference, &p.Status, &p.Amount, &p.CapturedAmount, &p.RefundedAmount, &p.Currency, &p.CreatedAt, &p.UpdatedAt)
+
+	return p, err
+}
+
+// insertPayment: records a payment of a reservation in tx and records it in the audit log
+func (m *postgressDBRepo) insertPayment(ctx context.Context, tx *sql.Tx, payment models.Payment, actor models.Actor) (int, error) {
+	query := `insert into payments (reservation_id, provider, reference, status, amount, captured_amount, refunded_amount, currency, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := tx.QueryRowContext(ctx, query, payment.ReservationID, payment.Provider, payment.Reference, payment.Status, payment.Amount,
+		payment.CapturedAmount, payment.RefundedAmount, payment.Currency, time.Now(), time.Now()).Scan(&payment.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return payment.ID, m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityPayment, payment.ID, nil, payment)
+}
+
+// PaymentsByReservation: returns the payments of a reservation, oldest first
+func (m *postgressDBRepo) PaymentsByReservation(ctx context.Context, reservationId int) ([]models.Payment, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "PaymentsByReservation")
+
+	var payments []models.Payment
+
+	rows, err := m.DB.QueryContext(ctx, `select `+paymentColumns+` from payments where reservation_id = $1 order by id`, reservationId)
+	if err != nil {
+		m.logError(ctx, "PaymentsByReservation", err)
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			m.logError(ctx, "PaymentsByReservation", err)
+			return payments, err
+		}
+		payments = append(payments, payment)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "PaymentsByReservation", err)
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// PaymentByReference: returns the payment the provider knows by reference, sql.ErrNoRows when there is none
+func (m *postgressDBRepo) PaymentByReference(ctx context.Context, provider, reference string) (models.Payment, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "PaymentByReference")
+
+	row := m.DB.QueryRowContext(ctx, `select `+paymentColumns+` from payments where provider = $1 and reference = $2`, provider, reference)
+
+	payment, err := scanPayment(row)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		m.logError(ctx, "PaymentByReference", err)
+	}
+
+	return payment, err
+}
+
+// UpdatePayment: saves the status and the captured and refunded amounts of a payment and records the change in the audit log
+func (m *postgressDBRepo) UpdatePayment(ctx context.Context, payment models.Payment, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "UpdatePayment")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "UpdatePayment", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.lockPayment(ctx, tx, payment.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "UpdatePayment", err)
+		}
+		return err
+	}
+
+	if err = m.updatePayment(ctx, tx, before, payment, actor); err != nil {
+		m.logError(ctx, "UpdatePayment", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "UpdatePayment", err)
+		return err
+	}
+
+	return nil
+}
+
+// ApplyPaymentEvent: applies an event of the provider to the payment and records the event, so the same event is applied once
+// * Returns false when the event was already recorded or is older than the payment's status, the payment is left as it is then
+func (m *postgressDBRepo) ApplyPaymentEvent(ctx context.Context, paymentId int, event models.PaymentEvent, actor models.Actor) (bool, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "ApplyPaymentEvent")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "ApplyPaymentEvent", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// * An event already recorded inserts nothing, the unique index makes a concurrent delivery of it wait and do the same
+	var eventId int
+	err = tx.QueryRowContext(ctx, `insert into payment_events (payment_id, provider, event_id, status, amount, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7) on conflict (provider, event_id) do nothing returning id`,
+		paymentId, event.Provider, event.ID, event.Status, event.Amount, time.Now(), time.Now()).Scan(&eventId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		m.logError(ctx, "ApplyPaymentEvent", err)
+		return false, err
+	}
+
+	before, err := m.lockPayment(ctx, tx, paymentId)
+	if err != nil {
+		m.logError(ctx, "ApplyPaymentEvent", err)
+		return false, err
+	}
+
+	// * A stale event is still recorded, so a later delivery of it is known too
+	after, applied := before.Apply(event)
+	if applied {
+		if err = m.updatePayment(ctx, tx, before, after, actor); err != nil {
+			m.logError(ctx, "ApplyPaymentEvent", err)
+			return false, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "ApplyPaymentEvent", err)
+		return false, err
+	}
+
+	return applied, nil
+}
+
+// lockPayment: returns the payment with the id, locked in tx until it is committed
+func (m *postgressDBRepo) lockPayment(ctx context.Context, tx *sql.Tx, id int) (models.Payment, error) {
+	return scanPayment(tx.QueryRowContext(ctx, `select `+paymentColumns+` from payments where id = $1 for update`, id))
+}
+
+// updatePayment: saves the status and amounts of payment in tx and records the change from before in the audit log
+func (m *postgressDBRepo) updatePayment(ctx context.Context, tx *sql.Tx, before, payment models.Payment, actor models.Actor) error {
+	after, err := scanPayment(tx.QueryRowContext(ctx, `update payments set status = $1, captured_amount = $2, refunded_amount = $3, updated_at = $4
+	where id = $5 returning `+paymentColumns, payment.Status, payment.CapturedAmount, payment.RefundedAmount, time.Now(), payment.ID))
+	if err != nil {
+		return err
+	}
+
+	return m.insertAudit(ctx, tx, actor, auditActionUpdate, auditEntityPayment, payment.ID, before, after)
+}
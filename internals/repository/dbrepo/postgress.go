@@ -2,30 +2,403 @@ package dbrepo
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
 	"errors"
+	"math/big"
+	"strings"
 	"time"
 
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
 	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgressDBRepo) AllUsers() bool {
+func (m *postgressDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
-// * InsertReservation: inserts a reservation into the database
-func (m *postgressDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	// * Context is used to set a timeout for the query to maintain the transaction atomicity
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// * Ping: checks that the database can be reached, ctx should carry the timeout
+func (m *postgressDBRepo) Ping(ctx context.Context) error {
+	return m.DB.PingContext(ctx)
+}
+
+// * Tries with a fresh confirmation code when a reservation already has the one drawn
+const confirmationCodeAttempts = 5
+
+// newConfirmationCode: draws a random confirmation code such as BNB-7K3Q9X
+func newConfirmationCode() (string, error) {
+	var code strings.Builder
+	code.WriteString(models.ConfirmationCodePrefix)
+
+	alphabetSize := big.NewInt(int64(len(models.ConfirmationCodeAlphabet)))
+	for i := 0; i < models.ConfirmationCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(models.ConfirmationCodeAlphabet[n.Int64()])
+	}
+
+	return code.String(), nil
+}
+
+// BookReservation: makes a reservation with a new confirmation code if its room is free, blocks the room for it and its cleaning,
+// records the payment holding its deposit and releases the holds of holder
+// * Everything is written in one transaction under a lock of the room, so two guests booking the same dates can't both succeed
+// * A payment without a reference, for a stay with nothing to pay, isn't recorded
+// * Returns the reservation as stored, with its id and confirmation code, or repository.ErrRoomUnavailable when the room was taken
+func (m *postgressDBRepo) BookReservation(ctx context.Context, res models.Reservation, payment models.Payment, holder string, actor models.Actor) (models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "BookReservation")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "BookReservation", err)
+		return res, err
+	}
+	defer tx.Rollback()
+
+	// * Locking the room makes a hold, change or booking of the same dates wait until this one is committed
+	var roomId int
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 and active for update`, res.RoomId).Scan(&roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, repository.ErrRoomUnavailable
+	}
+	if err != nil {
+		m.logError(ctx, "BookReservation", err)
+		return res, err
+	}
 
-	var resId int
+	var free bool
+	query := `select not exists(select 1 from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date)
+	and not exists(select 1 from room_holds where room_id = $1 and holder <> $4 and expires_at > $5 and $6 < end_date and $3 > start_date)`
+	err = tx.QueryRowContext(ctx, query, res.RoomId, res.StartDate, m.blockedUntil(res.EndDate), holder, time.Now(), m.heldFrom(res.StartDate)).Scan(&free)
+	if err != nil {
+		m.logError(ctx, "BookReservation", err)
+		return res, err
+	}
+	if !free {
+		return res, repository.ErrRoomUnavailable
+	}
+
+	res, err = m.insertReservation(ctx, tx, res, actor)
+	if err != nil {
+		m.logError(ctx, "BookReservation", err)
+		return res, err
+	}
+
+	reserved := models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		ReservationId: res.ID,
+		RoomID:        res.RoomId,
+		RestrictionID: models.RestrictionReservation,
+	}
+	for _, rr := range m.withCleaningBlock(reserved) {
+		if err = m.insertRoomRestriction(ctx, tx, rr, actor); err != nil {
+			m.logError(ctx, "BookReservation", err)
+			return res, err
+		}
+	}
+
+	if payment.Reference != "" {
+		payment.ReservationID = res.ID
+		if _, err = m.insertPayment(ctx, tx, payment, actor); err != nil {
+			m.logError(ctx, "BookReservation", err)
+			return res, err
+		}
+	}
+
+	// * The hold became a reservation
+	if holder != "" {
+		if _, err = tx.ExecContext(ctx, `delete from room_holds where holder = $1`, holder); err != nil {
+			m.logError(ctx, "BookReservation", err)
+			return res, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "BookReservation", err)
+		return res, err
+	}
+
+	metrics.ReservationsCreated.Inc()
+
+	return res, nil
+}
+
+// insertReservation: inserts a reservation with a new confirmation code in tx and records it in the audit log
+func (m *postgressDBRepo) insertReservation(ctx context.Context, tx *sql.Tx, res models.Reservation, actor models.Actor) (models.Reservation, error) {
+	if res.Status == "" {
+		res.Status = models.ReservationStatusConfirmed
+	}
 
 	// * `returning id` is used to return the id of the inserted row and this makes the `insert statement` a `query`
-	query := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
-	values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+	// * A code already taken inserts nothing instead of failing the transaction, so another code can be tried
+	query := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, room_id, status, adults, children, total_price, confirmation_code,
+		rate_plan_name, discount_percent, policy_name, free_cancellation_days, late_penalty_percent, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) on conflict (confirmation_code) do nothing returning id`
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		res.ConfirmationCode, err = newConfirmationCode()
+		if err != nil {
+			return res, err
+		}
+
+		err = tx.QueryRowContext(ctx, query,
+			res.FirstName,
+			res.LastName,
+			res.Email,
+			res.Phone,
+			res.StartDate,
+			res.EndDate,
+			res.RoomId,
+			res.Status,
+			res.Adults,
+			res.Children,
+			res.TotalPrice,
+			res.ConfirmationCode,
+			res.RatePlanName,
+			res.DiscountPercent,
+			res.Policy.Name,
+			res.Policy.FreeCancellationDays,
+			res.Policy.LatePenaltyPercent,
+			time.Now(),
+			time.Now(),
+		).Scan(&res.ID)
+
+		if !errors.Is(err, sql.ErrNoRows) || attempt == confirmationCodeAttempts {
+			break
+		}
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	return res, m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityReservation, res.ID, nil, res)
+}
+
+// * GetReservationById: returns a reservation along with its room
+func (m *postgressDBRepo) GetReservationById(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "GetReservationById")
+
+	return m.getReservationById(ctx, m.DB, id)
+}
+
+// * queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// * Reservations are read with their room, reservationColumns goes with scanReservation
+const reservationColumns = `r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.status, r.adults, r.children, r.total_price,
+	r.confirmation_code, r.rate_plan_name, r.discount_percent, r.policy_name, r.free_cancellation_days, r.late_penalty_percent, r.cancellation_fee,
+	r.created_at, r.updated_at, rm.id, rm.room_name, rm.slug, rm.created_at, rm.updated_at`
+
+func scanReservation(row scanner) (models.Reservation, error) {
+	var res models.Reservation
+
+	err := row.Scan(
+		&res.ID,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.StartDate,
+		&res.EndDate,
+		&res.RoomId,
+		&res.Status,
+		&res.Adults,
+		&res.Children,
+		&res.TotalPrice,
+		&res.ConfirmationCode,
+		&res.RatePlanName,
+		&res.DiscountPercent,
+		&res.Policy.Name,
+		&res.Policy.FreeCancellationDays,
+		&res.Policy.LatePenaltyPercent,
+		&res.CancellationFee,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+		&res.Room.ID,
+		&res.Room.RoomName,
+		&res.Room.Slug,
+		&res.Room.CreatedAt,
+		&res.Room.UpdatedAt,
+	)
+
+	return res, err
+}
+
+func (m *postgressDBRepo) getReservationById(ctx context.Context, db queryRower, id int) (models.Reservation, error) {
+	query := `select ` + reservationColumns + ` from reservations r left join rooms rm on rm.id = r.room_id where r.id = $1`
+
+	res, err := scanReservation(db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		m.logError(ctx, "getReservationById", err)
+		return res, err
+	}
+
+	return res, nil
+}
+
+// GetReservationByCode: returns the reservation with the confirmation code booked with email, sql.ErrNoRows when either doesn't match
+func (m *postgressDBRepo) GetReservationByCode(ctx context.Context, code, email string) (models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "GetReservationByCode")
+
+	query := `select ` + reservationColumns + ` from reservations r left join rooms rm on rm.id = r.room_id
+	where r.confirmation_code = $1 and lower(r.email) = lower($2)`
+
+	res, err := scanReservation(m.DB.QueryRowContext(ctx, query, code, email))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "GetReservationByCode", err)
+		}
+		return res, err
+	}
+
+	return res, nil
+}
+
+// ReservationIdByCode: returns the id of the reservation with the confirmation code, sql.ErrNoRows when there is none
+func (m *postgressDBRepo) ReservationIdByCode(ctx context.Context, code string) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "ReservationIdByCode")
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, `select id from reservations where confirmation_code = $1`, code).Scan(&id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "ReservationIdByCode", err)
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// * UpdateReservation: updates the guest details and dates of a reservation and records the change in the audit log
+func (m *postgressDBRepo) UpdateReservation(ctx context.Context, res models.Reservation, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "UpdateReservation")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "UpdateReservation", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.updateReservation(ctx, tx, res, actor); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "UpdateReservation", err)
+		return err
+	}
 
-	err := m.DB.QueryRowContext(ctx, query,
+	return nil
+}
+
+// ChangeReservation: moves a reservation to the dates and room of res, with its new price, if the room is free then
+// * The reservation's own restrictions don't count against it, the holds of holder are ignored
+// * The payment holding the rest of its deposit is recorded with it, unless it has no reference as nothing more is held
+// * Returns repository.ErrRoomUnavailable when the room is booked, held by another guest or inactive for the new dates
+// * and repository.ErrReservationCancelled when the reservation was cancelled before the change was confirmed
+func (m *postgressDBRepo) ChangeReservation(ctx context.Context, res models.Reservation, payment models.Payment, holder string, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "ChangeReservation")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "ChangeReservation", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	// * The reservation is locked so it can't be cancelled while it is being moved
+	_, err = tx.ExecContext(ctx, `select id from reservations where id = $1 for update`, res.ID)
+	if err != nil {
+		m.logError(ctx, "ChangeReservation", err)
+		return err
+	}
+
+	current, err := m.getReservationById(ctx, tx, res.ID)
+	if err != nil {
+		return err
+	}
+	if current.Cancelled() {
+		return repository.ErrReservationCancelled
+	}
+
+	// * Locking the room makes a hold or change of the same dates wait until this one is committed
+	var roomId int
+	err = tx.QueryRowContext(ctx, `select id from rooms where id = $1 and active for update`, res.RoomId).Scan(&roomId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrRoomUnavailable
+	}
+	if err != nil {
+		m.logError(ctx, "ChangeReservation", err)
+		return err
+	}
+
+	var free bool
+	query := `select not exists(select 1 from room_restrictions where room_id = $1 and coalesce(reservation_id, 0) <> $2 and $3 < end_date and $4 > start_date)
+	and not exists(select 1 from room_holds where room_id = $1 and holder <> $5 and expires_at > $6 and $7 < end_date and $4 > start_date)`
+	err = tx.QueryRowContext(ctx, query, res.RoomId, res.ID, res.StartDate, m.blockedUntil(res.EndDate), holder, time.Now(), m.heldFrom(res.StartDate)).Scan(&free)
+	if err != nil {
+		m.logError(ctx, "ChangeReservation", err)
+		return err
+	}
+	if !free {
+		return repository.ErrRoomUnavailable
+	}
+
+	if err = m.updateReservation(ctx, tx, res, actor); err != nil {
+		return err
+	}
+
+	if payment.Reference != "" {
+		payment.ReservationID = res.ID
+		if _, err = m.insertPayment(ctx, tx, payment, actor); err != nil {
+			m.logError(ctx, "ChangeReservation", err)
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "ChangeReservation", err)
+		return err
+	}
+
+	return nil
+}
+
+// updateReservation: updates a reservation in tx, records it in the audit log and moves its restrictions when the dates or room changed
+func (m *postgressDBRepo) updateReservation(ctx context.Context, tx *sql.Tx, res models.Reservation, actor models.Actor) error {
+	before, err := m.getReservationById(ctx, tx, res.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `update reservations set first_name = $1, last_name = $2, email = $3, phone = $4, start_date = $5, end_date = $6, room_id = $7,
+	adults = $8, children = $9, total_price = $10, updated_at = $11
+	where id = $12`
+
+	_, err = tx.ExecContext(ctx, query,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -33,89 +406,331 @@ func (m *postgressDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomId,
-		time.Time{},
-		time.Time{},
-	).Scan(&resId)
+		res.Adults,
+		res.Children,
+		res.TotalPrice,
+		time.Now(),
+		res.ID,
+	)
 
 	if err != nil {
-		m.App.ErrorLog.Println(err)
-		return 0, err
+		m.logError(ctx, "updateReservation", err)
+		return err
 	}
 
-	return resId, nil
+	after, err := m.getReservationById(ctx, tx, res.ID)
+	if err != nil {
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionUpdate, auditEntityReservation, res.ID, before, after)
+	if err != nil {
+		m.logError(ctx, "updateReservation", err)
+		return err
+	}
+
+	// * The reservation restriction and cleaning block follow the new dates and room, a cancelled reservation has none
+	if after.Status != models.ReservationStatusCancelled && (!after.StartDate.Equal(before.StartDate) || !after.EndDate.Equal(before.EndDate) || after.RoomId != before.RoomId) {
+		if err = m.deleteReservationRestrictions(ctx, tx, res.ID, actor); err != nil {
+			m.logError(ctx, "updateReservation", err)
+			return err
+		}
+
+		restrictions := m.withCleaningBlock(models.RoomRestriction{
+			StartDate:     after.StartDate,
+			EndDate:       after.EndDate,
+			ReservationId: after.ID,
+			RoomID:        after.RoomId,
+			RestrictionID: models.RestrictionReservation,
+		})
+		for _, rr := range restrictions {
+			if err = m.insertRoomRestriction(ctx, tx, rr, actor); err != nil {
+				m.logError(ctx, "updateReservation", err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// * CancelReservation: marks a reservation as cancelled with the fee charged for it and frees its room restrictions
+// * Returns repository.ErrReservationCancelled when it already is
+func (m *postgressDBRepo) CancelReservation(ctx context.Context, id, fee int, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "CancelReservation")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "CancelReservation", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	// * The row is locked so a reservation cancelled twice at once is only charged once
+	_, err = tx.ExecContext(ctx, `select id from reservations where id = $1 for update`, id)
+	if err != nil {
+		m.logError(ctx, "CancelReservation", err)
+		return err
+	}
+
+	before, err := m.getReservationById(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.Cancelled() {
+		return repository.ErrReservationCancelled
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set status = $1, cancellation_fee = $2, updated_at = $3 where id = $4`, models.ReservationStatusCancelled, fee, time.Now(), id)
+	if err != nil {
+		m.logError(ctx, "CancelReservation", err)
+		return err
+	}
+
+	after := before
+	after.Status = models.ReservationStatusCancelled
+	after.CancellationFee = fee
+
+	err = m.insertAudit(ctx, tx, actor, auditActionCancel, auditEntityReservation, id, before, after)
+	if err != nil {
+		m.logError(ctx, "CancelReservation", err)
+		return err
+	}
+
+	// * Removes the reservation restriction and its cleaning block
+	if err = m.deleteReservationRestrictions(ctx, tx, id, actor); err != nil {
+		m.logError(ctx, "CancelReservation", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "CancelReservation", err)
+		return err
+	}
+
+	metrics.ReservationsCancelled.Inc()
+
+	return nil
 }
 
-// * InsertReservation: inserts a reservation into the database
-func (m *postgressDBRepo) InsertRoomRestriction(roomRestriction models.RoomRestriction) error {
+// * InsertRoomRestriction: inserts a room restriction into the database and records it in the audit log
+// * A reservation restriction also gets the cleaning block after its checkout, in the same transaction
+func (m *postgressDBRepo) InsertRoomRestriction(ctx context.Context, roomRestriction models.RoomRestriction, actor models.Actor) error {
 	// * Context is used to set a timeout for the query to maintain the transaction atomicity
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertRoomRestriction")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertRoomRestriction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	restrictions := []models.RoomRestriction{roomRestriction}
+	if roomRestriction.RestrictionID == models.RestrictionReservation {
+		restrictions = m.withCleaningBlock(roomRestriction)
+	}
+
+	for _, rr := range restrictions {
+		if err = m.insertRoomRestriction(ctx, tx, rr, actor); err != nil {
+			m.logError(ctx, "InsertRoomRestriction", err)
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertRoomRestriction", err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *postgressDBRepo) insertRoomRestriction(ctx context.Context, tx *sql.Tx, roomRestriction models.RoomRestriction, actor models.Actor) error {
+	// * A restriction without a reservation (e.g. owner block) stores null in reservation_id
+	var reservationId sql.NullInt64
+	if roomRestriction.ReservationId > 0 {
+		reservationId = sql.NullInt64{Int64: int64(roomRestriction.ReservationId), Valid: true}
+	}
 
-	// * `returning id` is used to return the id of the inserted row and this makes the `insert statement` a `query`
 	query := `insert into room_restrictions (start_date, end_date, reservation_id, room_id, restriction_id, created_at, updated_at)
-	values ($1, $2, $3, $4, $5, $6, $7)`
+	values ($1, $2, $3, $4, $5, $6, $7) returning id`
 
-	_, err := m.DB.ExecContext(ctx, query,
+	err := tx.QueryRowContext(ctx, query,
 		roomRestriction.StartDate,
 		roomRestriction.EndDate,
-		roomRestriction.ReservationId,
+		reservationId,
 		roomRestriction.RoomID,
 		roomRestriction.RestrictionID,
-		time.Time{},
-		time.Time{},
-	)
+		time.Now(),
+		time.Now(),
+	).Scan(&roomRestriction.ID)
 
 	if err != nil {
-		m.App.ErrorLog.Println(err)
 		return err
 	}
 
+	return m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityRoomRestriction, roomRestriction.ID, nil, roomRestriction)
+}
+
+// blockedUntil: returns the end of a stay leaving on end_date including its cleaning block, which must not overlap another booking either
+func (m *postgressDBRepo) blockedUntil(end_date time.Time) time.Time {
+	return end_date.AddDate(0, 0, m.cleaningDays())
+}
+
+// cleaningDays: returns how many days a room is blocked for cleaning after each checkout
+func (m *postgressDBRepo) cleaningDays() int {
+	return max(0, m.App.CleaningDays)
+}
+
+// withCleaningBlock: returns the reservation restriction followed by the cleaning block starting on its checkout day, when cleaning days are set
+func (m *postgressDBRepo) withCleaningBlock(reservation models.RoomRestriction) []models.RoomRestriction {
+	restrictions := []models.RoomRestriction{reservation}
+
+	if days := m.cleaningDays(); days > 0 {
+		restrictions = append(restrictions, models.RoomRestriction{
+			StartDate:     reservation.EndDate,
+			EndDate:       reservation.EndDate.AddDate(0, 0, days),
+			ReservationId: reservation.ReservationId,
+			RoomID:        reservation.RoomID,
+			RestrictionID: models.RestrictionCleaning,
+		})
+	}
+
+	return restrictions
+}
+
+// deleteReservationRestrictions: deletes the room restrictions of a reservation one by one so that each removal is audited
+func (m *postgressDBRepo) deleteReservationRestrictions(ctx context.Context, tx *sql.Tx, reservationId int, actor models.Actor) error {
+	rows, err := tx.QueryContext(ctx, `delete from room_restrictions where reservation_id = $1
+	returning id, start_date, end_date, coalesce(reservation_id, 0), room_id, restriction_id`, reservationId)
+	if err != nil {
+		return err
+	}
+
+	var removed []models.RoomRestriction
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err = rows.Scan(&rr.ID, &rr.StartDate, &rr.EndDate, &rr.ReservationId, &rr.RoomID, &rr.RestrictionID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		removed = append(removed, rr)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rr := range removed {
+		err = m.insertAudit(ctx, tx, actor, auditActionDelete, auditEntityRoomRestriction, rr.ID, rr, nil)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// RoomRestrictionsBetween: returns the restrictions of active rooms overlapping from to to, of one room or of every room when roomId is 0
+func (m *postgressDBRepo) RoomRestrictionsBetween(ctx context.Context, roomId int, from, to time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "RoomRestrictionsBetween")
+
+	query := `select rr.id, rr.start_date, rr.end_date, coalesce(rr.reservation_id, 0), rr.room_id, rr.restriction_id
+	from room_restrictions rr join rooms r on r.id = rr.room_id
+	where r.active and $1 < rr.end_date and $2 > rr.start_date`
+	args := []interface{}{from, to}
+	if roomId > 0 {
+		query += ` and rr.room_id = $3`
+		args = append(args, roomId)
+	}
+	query += ` order by rr.room_id, rr.start_date`
+
+	var restrictions []models.RoomRestriction
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		m.logError(ctx, "RoomRestrictionsBetween", err)
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err = rows.Scan(&rr.ID, &rr.StartDate, &rr.EndDate, &rr.ReservationId, &rr.RoomID, &rr.RestrictionID)
+		if err != nil {
+			m.logError(ctx, "RoomRestrictionsBetween", err)
+			return restrictions, err
+		}
+		restrictions = append(restrictions, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "RoomRestrictionsBetween", err)
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
 // * SearchAvailabilityByDates: returns true if room is available, and false if not available for a single room
-func (m *postgressDBRepo) SearchAvailabilityByDatesByRoomId(start_date, end_date time.Time, roomId int) (bool, error) {
+// * Rooms held by another guest are not available, the holds of holder are ignored
+func (m *postgressDBRepo) SearchAvailabilityByDatesByRoomId(ctx context.Context, start_date, end_date time.Time, roomId int, holder string) (bool, error) {
 	// * Context is used to set a timeout for the query to maintain the transaction atomicity
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "SearchAvailabilityByDatesByRoomId")
 
-	var numRows int
+	var available bool
 
-	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date`
-	err := m.DB.QueryRowContext(ctx, query, roomId, start_date, end_date).Scan(&numRows)
+	// * An inactive room is never available
+	query := `select exists(select 1 from rooms where id = $1 and active)
+	and not exists(select 1 from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date)
+	and not exists(select 1 from room_holds where room_id = $1 and holder <> $4 and expires_at > $5 and $6 < end_date and $3 > start_date)`
+	err := m.DB.QueryRowContext(ctx, query, roomId, start_date, m.blockedUntil(end_date), holder, time.Now(), m.heldFrom(start_date)).Scan(&available)
 
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logError(ctx, "SearchAvailabilityByDatesByRoomId", err)
 		return false, err
 	}
 
-	if numRows == 0 {
-		return true, nil
-	}
-	return false, nil
+	return available, nil
 }
 
-// * SearchAvailabilityForAllRoomsByDates: returns a slice of available rooms, if any, for a given date range
-func (m *postgressDBRepo) SearchAvailabilityForAllRoomsByDates(start_date, end_date time.Time) ([]models.Room, error) {
+// * SearchAvailabilityForAllRoomsByDates: returns a slice of available rooms, if any, for a given date range which can sleep the given number of guests
+// * Rooms held by another guest are left out, the holds of holder are ignored
+func (m *postgressDBRepo) SearchAvailabilityForAllRoomsByDates(ctx context.Context, start_date, end_date time.Time, guests int, holder string) ([]models.Room, error) {
 	// * Context is used to set a timeout for the query to maintain the transaction atomicity
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "SearchAvailabilityForAllRoomsByDates")
 
 	// query := `select * from rooms inner join room_restrictions on rooms.id=room_restrictions.room_id where $1 < end_date and $2 > start_date`
-	query := `select r.id, r.room_name from rooms r where r.id not in (select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)`
-	rows, err := m.DB.QueryContext(ctx, query, start_date, end_date)
+	query := `select ` + roomColumns + ` from rooms r where r.active and r.capacity >= $3
+	and r.id not in (select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
+	and r.id not in (select room_id from room_holds h where h.holder <> $4 and h.expires_at > $5 and $6 < h.end_date and $2 > h.start_date)
+	order by r.room_name`
+	rows, err := m.DB.QueryContext(ctx, query, start_date, m.blockedUntil(end_date), guests, holder, time.Now(), m.heldFrom(start_date))
 
 	var availableRooms []models.Room
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logError(ctx, "SearchAvailabilityForAllRoomsByDates", err)
 		return availableRooms, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var room models.Room
-		err = rows.Scan(&room.ID, &room.RoomName)
+		room, err := scanRoom(rows)
 		if err != nil {
-			m.App.ErrorLog.Println(err)
+			m.logError(ctx, "SearchAvailabilityForAllRoomsByDates", err)
 			return availableRooms, err
 		}
 
@@ -123,35 +738,79 @@ func (m *postgressDBRepo) SearchAvailabilityForAllRoomsByDates(start_date, end_d
 	}
 
 	if err = rows.Err(); err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logError(ctx, "SearchAvailabilityForAllRoomsByDates", err)
 		return availableRooms, err
 	}
 
+	// * Photos are shown on the choose room page
+	photos, err := m.roomPhotos(ctx, m.DB, 0)
+	if err != nil {
+		m.logError(ctx, "SearchAvailabilityForAllRoomsByDates", err)
+		return availableRooms, err
+	}
+
+	for i := range availableRooms {
+		availableRooms[i].Photos = photos[availableRooms[i].ID]
+	}
+
 	return availableRooms, nil
 }
 
-// * SearchAvailabilityForAllRoomsByDates: returns a slice of available rooms, if any, for a given date range
-func (m *postgressDBRepo) GetRoomById(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SearchFlexibleAvailability: returns every room and arrival date for which a stay of nights nights fits between from and to, for the given number of guests
+// * One query checks every start date of the window against room_restrictions and the holds of other guests, stay rules are left to the caller
+func (m *postgressDBRepo) SearchFlexibleAvailability(ctx context.Context, from, to time.Time, nights, guests int, holder string) ([]models.StayOption, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "SearchFlexibleAvailability")
 
-	var room models.Room
+	var options []models.StayOption
 
-	query := `select id, room_name, created_at, updated_at from rooms where id = $1`
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+	// * The last arrival leaves on to, each stay also needs its cleaning block to be free
+	lastStart := to.AddDate(0, 0, -nights)
+	if lastStart.Before(from) {
+		return options, nil
+	}
 
+	query := `select s.day::date, ` + roomColumns + `
+	from rooms cross join generate_series($1::date, $2::date, interval '1 day') as s(day)
+	where active and capacity >= $4
+	and not exists(select 1 from room_restrictions rr where rr.room_id = rooms.id
+		and s.day < rr.end_date and s.day + make_interval(days => $3) > rr.start_date)
+	and not exists(select 1 from room_holds h where h.room_id = rooms.id and h.holder <> $5 and h.expires_at > $6
+		and s.day - make_interval(days => $7) < h.end_date and s.day + make_interval(days => $3) > h.start_date)
+	order by s.day, room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, from, lastStart, nights+m.cleaningDays(), guests, holder, time.Now(), m.cleaningDays())
 	if err != nil {
-		m.App.ErrorLog.Println(err)
-		return room, err
+		m.logError(ctx, "SearchFlexibleAvailability", err)
+		return options, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var start time.Time
+		room, err := scanRoom(prefixScanner{row: rows, prefix: []interface{}{&start}})
+		if err != nil {
+			m.logError(ctx, "SearchFlexibleAvailability", err)
+			return options, err
+		}
+
+		options = append(options, models.StayOption{Room: room, StartDate: start, EndDate: start.AddDate(0, 0, nights)})
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "SearchFlexibleAvailability", err)
+		return options, err
 	}
 
-	return room, nil
+	return options, nil
 }
 
 // * GetUserByEmail: returns a user by email
-func (m *postgressDBRepo) GetUserById(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgressDBRepo) GetUserById(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "GetUserById")
 
 	var user models.User
 
@@ -159,69 +818,132 @@ func (m *postgressDBRepo) GetUserById(id int) (models.User, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.AccessLevel, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logError(ctx, "GetUserById", err)
 		return user, err
 	}
 
 	return user, nil
 }
 
-// * UpdateUser: updates a user in the database
-func (m *postgressDBRepo) UpdateUser(user models.User) error {
+// * UpdateUser: updates a user in the database and records the change in the audit log
+func (m *postgressDBRepo) UpdateUser(ctx context.Context, user models.User, actor models.Actor) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "UpdateUser")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "UpdateUser", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var before models.User
+	err = tx.QueryRowContext(ctx, `select id, first_name, last_name, email, access_level from users where id = $1 for update`, user.ID).
+		Scan(&before.ID, &before.FirstName, &before.LastName, &before.Email, &before.AccessLevel)
+	if err != nil {
+		m.logError(ctx, "UpdateUser", err)
+		return err
+	}
 
 	query := `update users set first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5 where id = $6`
-	_, err := m.DB.ExecContext(ctx, query, user.FirstName, user.LastName, user.Email, user.AccessLevel, time.Now(), user.ID)
+	_, err = tx.ExecContext(ctx, query, user.FirstName, user.LastName, user.Email, user.AccessLevel, time.Now(), user.ID)
 
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logError(ctx, "UpdateUser", err)
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionUpdate, auditEntityUser, user.ID, before, user)
+	if err != nil {
+		m.logError(ctx, "UpdateUser", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "UpdateUser", err)
 		return err
 	}
 
 	return nil
 }
 
-// * Authenticate: returns user id and hashed password if email and password are correct
-func (m *postgressDBRepo) Authenticate(email, testPassword string) (models.User, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// * Authenticate: returns user id and hashed password if email and password are correct, every attempt is recorded in the audit log
+func (m *postgressDBRepo) Authenticate(ctx context.Context, email, testPassword string, actor models.Actor) (models.User, string, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "Authenticate")
 
 	var user models.User
 	var hashedPassword string
 
+	// * The attempted email is recorded as the actor since nobody is logged in yet
+	actor.Email = email
+
 	query := `select id, first_name, last_name, email, access_level, password from users where email = $1`
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.AccessLevel, &hashedPassword)
 
 	if err != nil {
+		m.auditLogin(ctx, actor, auditActionLoginFailed, 0)
 		return user, "", err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
 	if err == bcrypt.ErrMismatchedHashAndPassword {
+		m.auditLogin(ctx, actor, auditActionLoginFailed, user.ID)
 		return user, "", errors.New("incorrect password")
 	} else if err != nil {
 		return user, "", err
 	}
 
+	actor.UserID = user.ID
+	m.auditLogin(ctx, actor, auditActionLogin, user.ID)
+
 	return user, hashedPassword, nil
 }
 
-// * InsertUser: inserts a user into the database
-func (m *postgressDBRepo) InsertUser(user models.User) (models.User, error) {
+// auditLogin: records a login attempt, a failure to write it is logged but does not block the login
+func (m *postgressDBRepo) auditLogin(ctx context.Context, actor models.Actor, action string, userId int) {
+	err := m.insertAudit(ctx, m.DB, actor, action, auditEntityUser, userId, nil, nil)
+	if err != nil {
+		m.logError(ctx, "auditLogin", err)
+	}
+}
+
+// * InsertUser: inserts a user into the database and records it in the audit log
+func (m *postgressDBRepo) InsertUser(ctx context.Context, user models.User, actor models.Actor) (models.User, error) {
 	// * Context is used to set a timeout for the query to maintain the transaction atomicity
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertUser")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertUser", err)
+		return models.User{}, err
+	}
+	defer tx.Rollback()
 
 	// * `returning id` is used to return the id of the inserted row and this makes the `insert statement` a `query`
 	query := `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at) 
 	values ($1, $2, $3, $4, $5, $6, $7) returning id`
 
-	err := m.DB.QueryRowContext(ctx, query, user.FirstName, user.LastName, user.Email, user.Password, user.AccessLevel, time.Now(), time.Now()).Scan(&user.ID)
+	err = tx.QueryRowContext(ctx, query, user.FirstName, user.LastName, user.Email, user.Password, user.AccessLevel, time.Now(), time.Now()).Scan(&user.ID)
 
 	if err != nil {
-		m.App.ErrorLog.Println(err)
+		m.logError(ctx, "InsertUser", err)
+		return models.User{}, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityUser, user.ID, nil, user)
+	if err != nil {
+		m.logError(ctx, "InsertUser", err)
+		return models.User{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertUser", err)
 		return models.User{}, err
 	}
 
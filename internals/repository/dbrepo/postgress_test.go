@@ -0,0 +1,347 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/imrcht/bed-n-breakfast/internals/config"
+	"github.com/imrcht/bed-n-breakfast/internals/logging"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+var errInsert = errors.New("insert failed")
+
+// sameRestriction: compares the dates, ids and type of two room restrictions
+func sameRestriction(a, b models.RoomRestriction) bool {
+	return a.StartDate.Equal(b.StartDate) && a.EndDate.Equal(b.EndDate) &&
+		a.ReservationId == b.ReservationId && a.RoomID == b.RoomID && a.RestrictionID == b.RestrictionID
+}
+
+func TestWithCleaningBlock(t *testing.T) {
+	start := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+
+	reservation := models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		ReservationId: 7,
+		RoomID:        2,
+		RestrictionID: models.RestrictionReservation,
+	}
+
+	tests := []struct {
+		name         string
+		cleaningDays int
+		wantBlockEnd time.Time
+	}{
+		{name: "no cleaning", cleaningDays: 0},
+		{name: "negative is no cleaning", cleaningDays: -2},
+		{name: "one day", cleaningDays: 1, wantBlockEnd: end.AddDate(0, 0, 1)},
+		{name: "two days", cleaningDays: 2, wantBlockEnd: end.AddDate(0, 0, 2)},
+	}
+
+	for _, tt := range tests {
+		m := &postgressDBRepo{App: &config.AppConfig{CleaningDays: tt.cleaningDays}}
+		got := m.withCleaningBlock(reservation)
+
+		if !sameRestriction(got[0], reservation) {
+			t.Errorf("%s: first restriction is %+v, want the reservation", tt.name, got[0])
+		}
+
+		if tt.wantBlockEnd.IsZero() {
+			if len(got) != 1 {
+				t.Errorf("%s: got %d restrictions, want only the reservation", tt.name, len(got))
+			}
+			continue
+		}
+
+		if len(got) != 2 {
+			t.Errorf("%s: got %d restrictions, want the reservation and a cleaning block", tt.name, len(got))
+			continue
+		}
+		want := models.RoomRestriction{
+			StartDate:     end,
+			EndDate:       tt.wantBlockEnd,
+			ReservationId: 7,
+			RoomID:        2,
+			RestrictionID: models.RestrictionCleaning,
+		}
+		if !sameRestriction(got[1], want) {
+			t.Errorf("%s: cleaning block is %+v, want %+v", tt.name, got[1], want)
+		}
+	}
+}
+
+// newMockRepo: returns a repository on a mocked database, the mock checks every statement of a transaction in order
+func newMockRepo(t *testing.T, app *config.AppConfig) (*postgressDBRepo, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	app.Logger = logging.New(io.Discard, false)
+	return &postgressDBRepo{App: app, DB: db}, mock
+}
+
+func TestBookReservation(t *testing.T) {
+	start := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{FirstName: "Ada", Email: "ada@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomId: 2}
+
+	// * expectBooking: the statements after the room is locked and found free, with one restriction insert per block
+	expectBooking := func(mock sqlmock.Sqlmock, blocks int) {
+		mock.ExpectQuery(`insert into reservations`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(41))
+		mock.ExpectExec(`insert into audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+		for i := 0; i < blocks; i++ {
+			mock.ExpectQuery(`insert into room_restrictions`).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullInt64{Int64: 41, Valid: true}, 2, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(100 + i))
+			mock.ExpectExec(`insert into audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+	}
+
+	tests := []struct {
+		name         string
+		holder       string
+		cleaningDays int
+		payment      models.Payment
+		expect       func(mock sqlmock.Sqlmock)
+		wantErr      error
+		wantID       int
+	}{
+		{
+			name:         "hold becomes a reservation",
+			holder:       "session-1",
+			cleaningDays: 1,
+			payment:      models.Payment{Provider: "fake", Reference: "pi_1", Status: models.PaymentAuthorized, Amount: 20000},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`select id from rooms where id = \$1 and active for update`).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				expectBooking(mock, 2)
+				mock.ExpectQuery(`insert into payments`).WithArgs(41, "fake", "pi_1", models.PaymentAuthorized, 20000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+				mock.ExpectExec(`insert into audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`delete from room_holds where holder = \$1`).WithArgs("session-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantID: 41,
+		},
+		{
+			name: "without a hold nothing is released",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`for update`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				expectBooking(mock, 1)
+				mock.ExpectCommit()
+			},
+			wantID: 41,
+		},
+		{
+			name: "taken confirmation code is drawn again",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`for update`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				mock.ExpectQuery(`insert into reservations .* on conflict \(confirmation_code\) do nothing`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				expectBooking(mock, 1)
+				mock.ExpectCommit()
+			},
+			wantID: 41,
+		},
+		{
+			name: "no free confirmation code",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`for update`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				for i := 0; i < confirmationCodeAttempts; i++ {
+					mock.ExpectQuery(`insert into reservations`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				}
+				mock.ExpectRollback()
+			},
+			wantErr: sql.ErrNoRows,
+		},
+		{
+			name:   "inactive room",
+			holder: "session-1",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`for update`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+			},
+			wantErr: repository.ErrRoomUnavailable,
+		},
+		{
+			name:   "dates taken or held by someone else",
+			holder: "session-1",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`for update`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(false))
+				mock.ExpectRollback()
+			},
+			wantErr: repository.ErrRoomUnavailable,
+		},
+		{
+			name:   "failed insert rolls back",
+			holder: "session-1",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`for update`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				mock.ExpectQuery(`insert into reservations`).WillReturnError(errInsert)
+				mock.ExpectRollback()
+			},
+			wantErr: errInsert,
+		},
+	}
+
+	for _, tt := range tests {
+		m, mock := newMockRepo(t, &config.AppConfig{CleaningDays: tt.cleaningDays})
+		tt.expect(mock)
+
+		got, err := m.BookReservation(context.Background(), res, tt.payment, tt.holder, models.Actor{IP: "127.0.0.1"})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error is %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && got.ID != tt.wantID {
+			t.Errorf("%s: reservation id is %d, want %d", tt.name, got.ID, tt.wantID)
+		}
+		if err == nil && !confirmationCodePattern.MatchString(got.ConfirmationCode) {
+			t.Errorf("%s: confirmation code is %q", tt.name, got.ConfirmationCode)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+var confirmationCodePattern = regexp.MustCompile(`^BNB-[23456789ABCDEFGHJKMNPQRSTVWXYZ]{6}$`)
+
+func TestNewConfirmationCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := newConfirmationCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !confirmationCodePattern.MatchString(code) {
+			t.Fatalf("code %q is not BNB- and 6 characters of the alphabet", code)
+		}
+		seen[code] = true
+	}
+
+	// * 100 draws from 30^6 codes repeating would mean the codes are not random
+	if len(seen) < 99 {
+		t.Errorf("only %d different codes in 100 draws", len(seen))
+	}
+}
+
+// reservationRows: returns res as the row read by getReservationById
+func reservationRows(res models.Reservation) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "first_name", "last_name", "email", "phone", "start_date", "end_date", "room_id", "status", "adults", "children", "total_price",
+		"confirmation_code", "rate_plan_name", "discount_percent", "policy_name", "free_cancellation_days", "late_penalty_percent", "cancellation_fee",
+		"created_at", "updated_at", "room_id", "room_name", "slug", "created_at", "updated_at"}).
+		AddRow(res.ID, res.FirstName, res.LastName, res.Email, res.Phone, res.StartDate, res.EndDate, res.RoomId, res.Status, res.Adults, res.Children, res.TotalPrice,
+			res.ConfirmationCode, res.RatePlanName, res.DiscountPercent, res.Policy.Name, res.Policy.FreeCancellationDays, res.Policy.LatePenaltyPercent, res.CancellationFee,
+			res.CreatedAt, res.UpdatedAt, res.RoomId, "Suite", "suite", res.CreatedAt, res.UpdatedAt)
+}
+
+func TestChangeReservation(t *testing.T) {
+	start := time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC)
+	current := models.Reservation{ID: 7, FirstName: "Ada", StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomId: 2, Status: models.ReservationStatusConfirmed, Adults: 2, TotalPrice: 20000}
+
+	// * Only the price changes so the restrictions stay where they are
+	change := current
+	change.TotalPrice = 24000
+
+	cancelled := current
+	cancelled.Status = models.ReservationStatusCancelled
+
+	tests := []struct {
+		name    string
+		payment models.Payment
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "changed",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`select id from reservations where id = \$1 for update`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(current))
+				mock.ExpectQuery(`select id from rooms where id = \$1 and active for update`).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(current))
+				mock.ExpectExec(`update reservations set`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(change))
+				mock.ExpectExec(`insert into audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "changed with the rest of the deposit held",
+			payment: models.Payment{Provider: "fake", Reference: "pi_2", Status: models.PaymentAuthorized, Amount: 4000},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`select id from reservations where id = \$1 for update`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(current))
+				mock.ExpectQuery(`select id from rooms where id = \$1 and active for update`).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(true))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(current))
+				mock.ExpectExec(`update reservations set`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(change))
+				mock.ExpectExec(`insert into audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`insert into payments`).WithArgs(7, "fake", "pi_2", models.PaymentAuthorized, 4000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(6))
+				mock.ExpectExec(`insert into audit_logs`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "cancelled before the change was confirmed",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`select id from reservations where id = \$1 for update`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`from reservations r`).WithArgs(7).WillReturnRows(reservationRows(cancelled))
+				mock.ExpectRollback()
+			},
+			wantErr: repository.ErrReservationCancelled,
+		},
+		{
+			name: "room taken",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`for update`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`from reservations r`).WillReturnRows(reservationRows(current))
+				mock.ExpectQuery(`select id from rooms`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`select not exists`).WillReturnRows(sqlmock.NewRows([]string{"free"}).AddRow(false))
+				mock.ExpectRollback()
+			},
+			wantErr: repository.ErrRoomUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		m, mock := newMockRepo(t, &config.AppConfig{})
+		tt.expect(mock)
+
+		err := m.ChangeReservation(context.Background(), change, tt.payment, "session-1", models.Actor{Email: "ada@example.com"})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error is %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+)
+
+const (
+	auditEntityCancellationPolicy = "cancellation_policy"
+	auditEntityRatePlan           = "rate_plan"
+
+	cancellationPolicyColumns = `id, name, free_cancellation_days, late_penalty_percent, created_at, updated_at`
+)
+
+func scanCancellationPolicy(row scanner) (models.CancellationPolicy, error) {
+	var policy models.CancellationPolicy
+
+	err := row.Scan(&policy.ID, &policy.Name, &policy.FreeCancellationDays, &policy.LatePenaltyPercent, &policy.CreatedAt, &policy.UpdatedAt)
+
+	return policy, err
+}
+
+// CancellationPolicies: returns every cancellation policy by name
+func (m *postgressDBRepo) CancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "CancellationPolicies")
+
+	var policies []models.CancellationPolicy
+
+	rows, err := m.DB.QueryContext(ctx, `select `+cancellationPolicyColumns+` from cancellation_policies order by name`)
+	if err != nil {
+		m.logError(ctx, "CancellationPolicies", err)
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		policy, err := scanCancellationPolicy(rows)
+		if err != nil {
+			m.logError(ctx, "CancellationPolicies", err)
+			return policies, err
+		}
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "CancellationPolicies", err)
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+// InsertCancellationPolicy: adds a cancellation policy and records it in the audit log
+func (m *postgressDBRepo) InsertCancellationPolicy(ctx context.Context, policy models.CancellationPolicy, actor models.Actor) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertCancellationPolicy")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertCancellationPolicy", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into cancellation_policies (name, free_cancellation_days, late_penalty_percent, created_at, updated_at)
+	values ($1, $2, $3, $4, $5) returning id`
+
+	err = tx.QueryRowContext(ctx, query, policy.Name, policy.FreeCancellationDays, policy.LatePenaltyPercent, time.Now(), time.Now()).Scan(&policy.ID)
+	if err != nil {
+		m.logError(ctx, "InsertCancellationPolicy", err)
+		return 0, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityCancellationPolicy, policy.ID, nil, policy)
+	if err != nil {
+		m.logError(ctx, "InsertCancellationPolicy", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertCancellationPolicy", err)
+		return 0, err
+	}
+
+	return policy.ID, nil
+}
+
+// DeleteCancellationPolicy: deletes a cancellation policy, repository.ErrPolicyInUse while rate plans use it
+// * Reservations keep their own copy of the policy, so deleting it doesn't change them
+func (m *postgressDBRepo) DeleteCancellationPolicy(ctx context.Context, id int, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "DeleteCancellationPolicy")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteCancellationPolicy", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var used bool
+	err = tx.QueryRowContext(ctx, `select exists(select 1 from rate_plans where cancellation_policy_id = $1)`, id).Scan(&used)
+	if err != nil {
+		m.logError(ctx, "DeleteCancellationPolicy", err)
+		return err
+	}
+	if used {
+		return repository.ErrPolicyInUse
+	}
+
+	policy, err := scanCancellationPolicy(tx.QueryRowContext(ctx, `delete from cancellation_policies where id = $1 returning `+cancellationPolicyColumns, id))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "DeleteCancellationPolicy", err)
+		}
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionDelete, auditEntityCancellationPolicy, policy.ID, policy, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteCancellationPolicy", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "DeleteCancellationPolicy", err)
+		return err
+	}
+
+	return nil
+}
+
+// RatePlans: returns the rate plans of one room, or of every room when roomId is 0, each with its cancellation policy
+func (m *postgressDBRepo) RatePlans(ctx context.Context, roomId int) ([]models.RatePlan, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "RatePlans")
+
+	query := `select rp.id, rp.room_id, rp.name, rp.discount_percent, rp.cancellation_policy_id, rp.created_at, rp.updated_at,
+	cp.id, cp.name, cp.free_cancellation_days, cp.late_penalty_percent, cp.created_at, cp.updated_at
+	from rate_plans rp join cancellation_policies cp on cp.id = rp.cancellation_policy_id`
+	var args []interface{}
+	if roomId > 0 {
+		query += ` where rp.room_id = $1`
+		args = append(args, roomId)
+	}
+	query += ` order by rp.room_id, rp.discount_percent, rp.id`
+
+	var plans []models.RatePlan
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		m.logError(ctx, "RatePlans", err)
+		return plans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var plan models.RatePlan
+		err = rows.Scan(&plan.ID, &plan.RoomID, &plan.Name, &plan.DiscountPercent, &plan.CancellationPolicyID, &plan.CreatedAt, &plan.UpdatedAt,
+			&plan.Policy.ID, &plan.Policy.Name, &plan.Policy.FreeCancellationDays, &plan.Policy.LatePenaltyPercent, &plan.Policy.CreatedAt, &plan.Policy.UpdatedAt)
+		if err != nil {
+			m.logError(ctx, "RatePlans", err)
+			return plans, err
+		}
+		plans = append(plans, plan)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "RatePlans", err)
+		return plans, err
+	}
+
+	return plans, nil
+}
+
+// InsertRatePlan: adds a rate plan to a room and records it in the audit log
+func (m *postgressDBRepo) InsertRatePlan(ctx context.Context, plan models.RatePlan, actor models.Actor) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertRatePlan")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertRatePlan", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into rate_plans (room_id, name, discount_percent, cancellation_policy_id, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err = tx.QueryRowContext(ctx, query, plan.RoomID, plan.Name, plan.DiscountPercent, plan.CancellationPolicyID, time.Now(), time.Now()).Scan(&plan.ID)
+	if err != nil {
+		m.logError(ctx, "InsertRatePlan", err)
+		return 0, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityRatePlan, plan.ID, nil, plan)
+	if err != nil {
+		m.logError(ctx, "InsertRatePlan", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertRatePlan", err)
+		return 0, err
+	}
+
+	return plan.ID, nil
+}
+
+// DeleteRatePlan: deletes a rate plan of the room, sql.ErrNoRows when the room has no such plan
+func (m *postgressDBRepo) DeleteRatePlan(ctx context.Context, roomId, planId int, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "DeleteRatePlan")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteRatePlan", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var plan models.RatePlan
+	err = tx.QueryRowContext(ctx, `delete from rate_plans where id = $1 and room_id = $2
+	returning id, room_id, name, discount_percent, cancellation_policy_id, created_at, updated_at`, planId, roomId).Scan(
+		&plan.ID, &plan.RoomID, &plan.Name, &plan.DiscountPercent, &plan.CancellationPolicyID, &plan.CreatedAt, &plan.UpdatedAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "DeleteRatePlan", err)
+		}
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionDelete, auditEntityRatePlan, plan.ID, plan, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteRatePlan", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "DeleteRatePlan", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,499 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+	"github.com/imrcht/bed-n-breakfast/internals/repository"
+	"github.com/jackc/pgconn"
+)
+
+const (
+	auditEntityRoom      = "room"
+	auditEntityRoomPhoto = "room_photo"
+
+	roomColumns = `id, room_name, slug, description, capacity, amenities, active, nightly_rate, included_guests, extra_adult_fee, extra_child_fee, created_at, updated_at`
+
+	// * Postgres error code of a unique index violation
+	uniqueViolation = "23505"
+)
+
+// * scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// * roomAudit is what is written to the audit log for a room, photos and stay rules are audited on their own
+type roomAudit struct {
+	models.Room
+	Photos    []models.RoomPhoto `json:"-"`
+	StayRules []models.StayRule  `json:"-"`
+}
+
+// * prefixScanner scans the leading columns of a row into prefix and hands the rest on, so scanRoom can read rooms joined after other columns
+type prefixScanner struct {
+	row    scanner
+	prefix []interface{}
+}
+
+func (p prefixScanner) Scan(dest ...interface{}) error {
+	return p.row.Scan(append(p.prefix, dest...)...)
+}
+
+func newRoomAudit(room models.Room) roomAudit {
+	return roomAudit{Room: room}
+}
+
+func scanRoom(row scanner) (models.Room, error) {
+	var room models.Room
+	var amenities []byte
+
+	err := row.Scan(&room.ID, &room.RoomName, &room.Slug, &room.Description, &room.Capacity, &amenities, &room.Active,
+		&room.NightlyRate, &room.IncludedGuests, &room.ExtraAdultFee, &room.ExtraChildFee, &room.CreatedAt, &room.UpdatedAt)
+	if err != nil {
+		return room, err
+	}
+
+	err = json.Unmarshal(amenities, &room.Amenities)
+	return room, err
+}
+
+// AllRooms: returns the rooms ordered by name with their photos, only the active ones when activeOnly is set
+func (m *postgressDBRepo) AllRooms(ctx context.Context, activeOnly bool) ([]models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "AllRooms")
+
+	query := `select ` + roomColumns + ` from rooms`
+	if activeOnly {
+		query += ` where active`
+	}
+	query += ` order by room_name, id`
+
+	var rooms []models.Room
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		m.logError(ctx, "AllRooms", err)
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			m.logError(ctx, "AllRooms", err)
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "AllRooms", err)
+		return rooms, err
+	}
+
+	// * There are only a handful of rooms, so all photos are read at once and grouped
+	photos, err := m.roomPhotos(ctx, m.DB, 0)
+	if err != nil {
+		m.logError(ctx, "AllRooms", err)
+		return rooms, err
+	}
+
+	for i := range rooms {
+		rooms[i].Photos = photos[rooms[i].ID]
+	}
+
+	return rooms, nil
+}
+
+// * GetRoomById: returns a room with its photos
+func (m *postgressDBRepo) GetRoomById(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "GetRoomById")
+
+	room, err := m.getRoom(ctx, m.DB, `id = $1`, id)
+	if err != nil {
+		m.logError(ctx, "GetRoomById", err)
+	}
+
+	return room, err
+}
+
+// GetRoomBySlug: returns a room with its photos, sql.ErrNoRows when no room has the slug
+func (m *postgressDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "GetRoomBySlug")
+
+	room, err := m.getRoom(ctx, m.DB, `slug = $1`, slug)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		m.logError(ctx, "GetRoomBySlug", err)
+	}
+
+	return room, err
+}
+
+// * queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	queryRower
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (m *postgressDBRepo) getRoom(ctx context.Context, db queryer, condition string, arg interface{}) (models.Room, error) {
+	room, err := scanRoom(db.QueryRowContext(ctx, `select `+roomColumns+` from rooms where `+condition, arg))
+	if err != nil {
+		return room, err
+	}
+
+	photos, err := m.roomPhotos(ctx, db, room.ID)
+	if err != nil {
+		return room, err
+	}
+	room.Photos = photos[room.ID]
+
+	return room, nil
+}
+
+// roomPhotos: returns the photos of a room, or of every room when roomId is 0, grouped by room id
+func (m *postgressDBRepo) roomPhotos(ctx context.Context, db queryer, roomId int) (map[int][]models.RoomPhoto, error) {
+	query := `select id, room_id, url, thumb_url, medium_url, position, created_at, updated_at from room_photos`
+	var args []interface{}
+	if roomId > 0 {
+		query += ` where room_id = $1`
+		args = append(args, roomId)
+	}
+	query += ` order by room_id, position, id`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := map[int][]models.RoomPhoto{}
+	for rows.Next() {
+		var photo models.RoomPhoto
+		err = rows.Scan(&photo.ID, &photo.RoomID, &photo.URL, &photo.ThumbURL, &photo.MediumURL, &photo.Position, &photo.CreatedAt, &photo.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		photos[photo.RoomID] = append(photos[photo.RoomID], photo)
+	}
+
+	return photos, rows.Err()
+}
+
+// InsertRoom: adds a room and records it in the audit log
+func (m *postgressDBRepo) InsertRoom(ctx context.Context, room models.Room, actor models.Actor) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertRoom")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertRoom", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	amenities, err := json.Marshal(nonNil(room.Amenities))
+	if err != nil {
+		return 0, err
+	}
+
+	query := `insert into rooms (room_name, slug, description, capacity, amenities, active, nightly_rate, included_guests, extra_adult_fee, extra_child_fee, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id`
+
+	err = tx.QueryRowContext(ctx, query, room.RoomName, room.Slug, room.Description, room.Capacity, string(amenities), room.Active,
+		room.NightlyRate, room.IncludedGuests, room.ExtraAdultFee, room.ExtraChildFee, time.Now(), time.Now()).Scan(&room.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, repository.ErrDuplicateSlug
+		}
+		m.logError(ctx, "InsertRoom", err)
+		return 0, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityRoom, room.ID, nil, newRoomAudit(room))
+	if err != nil {
+		m.logError(ctx, "InsertRoom", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertRoom", err)
+		return 0, err
+	}
+
+	return room.ID, nil
+}
+
+// UpdateRoom: updates a room and records the change in the audit log
+func (m *postgressDBRepo) UpdateRoom(ctx context.Context, room models.Room, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "UpdateRoom")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "UpdateRoom", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getRoom(ctx, tx, `id = $1`, room.ID)
+	if err != nil {
+		m.logError(ctx, "UpdateRoom", err)
+		return err
+	}
+
+	amenities, err := json.Marshal(nonNil(room.Amenities))
+	if err != nil {
+		return err
+	}
+
+	query := `update rooms set room_name = $1, slug = $2, description = $3, capacity = $4, amenities = $5, active = $6,
+	nightly_rate = $7, included_guests = $8, extra_adult_fee = $9, extra_child_fee = $10, updated_at = $11 where id = $12`
+
+	_, err = tx.ExecContext(ctx, query, room.RoomName, room.Slug, room.Description, room.Capacity, string(amenities), room.Active,
+		room.NightlyRate, room.IncludedGuests, room.ExtraAdultFee, room.ExtraChildFee, time.Now(), room.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return repository.ErrDuplicateSlug
+		}
+		m.logError(ctx, "UpdateRoom", err)
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionUpdate, auditEntityRoom, room.ID, newRoomAudit(before), newRoomAudit(room))
+	if err != nil {
+		m.logError(ctx, "UpdateRoom", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "UpdateRoom", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRoom: deletes a room which was never reserved, a reserved room should be deactivated instead so its history is kept
+func (m *postgressDBRepo) DeleteRoom(ctx context.Context, id int, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "DeleteRoom")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteRoom", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getRoom(ctx, tx, `id = $1`, id)
+	if err != nil {
+		m.logError(ctx, "DeleteRoom", err)
+		return err
+	}
+
+	// * Reservations cascade on the room foreign key, so a reserved room must never be deleted
+	var reserved bool
+	err = tx.QueryRowContext(ctx, `select exists(select 1 from reservations where room_id = $1)`, id).Scan(&reserved)
+	if err != nil {
+		m.logError(ctx, "DeleteRoom", err)
+		return err
+	}
+	if reserved {
+		return repository.ErrRoomHasReservations
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from rooms where id = $1`, id)
+	if err != nil {
+		m.logError(ctx, "DeleteRoom", err)
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionDelete, auditEntityRoom, id, newRoomAudit(before), nil)
+	if err != nil {
+		m.logError(ctx, "DeleteRoom", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "DeleteRoom", err)
+		return err
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// nonNil: keeps an empty list from being stored as json null
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// InsertRoomPhoto: adds a photo after the existing photos of its room and records it in the audit log
+func (m *postgressDBRepo) InsertRoomPhoto(ctx context.Context, photo models.RoomPhoto, actor models.Actor) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertRoomPhoto")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertRoomPhoto", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into room_photos (room_id, url, thumb_url, medium_url, position, created_at, updated_at)
+	values ($1, $2, $3, $4, (select coalesce(max(position) + 1, 0) from room_photos where room_id = $1), $5, $6)
+	returning id, position`
+
+	err = tx.QueryRowContext(ctx, query, photo.RoomID, photo.URL, photo.ThumbURL, photo.MediumURL, time.Now(), time.Now()).Scan(&photo.ID, &photo.Position)
+	if err != nil {
+		m.logError(ctx, "InsertRoomPhoto", err)
+		return 0, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityRoomPhoto, photo.ID, nil, photo)
+	if err != nil {
+		m.logError(ctx, "InsertRoomPhoto", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertRoomPhoto", err)
+		return 0, err
+	}
+
+	return photo.ID, nil
+}
+
+// MoveRoomPhoto: moves a photo of the room one place earlier (offset -1) or later (offset 1) and records it in the audit log
+func (m *postgressDBRepo) MoveRoomPhoto(ctx context.Context, roomId, photoId, offset int, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "MoveRoomPhoto")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "MoveRoomPhoto", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	// * Lock the photos of the room so two moves at once can't give photos the same position
+	_, err = tx.ExecContext(ctx, `select id from room_photos where room_id = $1 for update`, roomId)
+	if err != nil {
+		m.logError(ctx, "MoveRoomPhoto", err)
+		return err
+	}
+
+	grouped, err := m.roomPhotos(ctx, tx, roomId)
+	if err != nil {
+		m.logError(ctx, "MoveRoomPhoto", err)
+		return err
+	}
+	photos := grouped[roomId]
+
+	from := -1
+	for i, photo := range photos {
+		if photo.ID == photoId {
+			from = i
+		}
+	}
+	if from == -1 {
+		return sql.ErrNoRows
+	}
+
+	to := from + offset
+	if to < 0 || to >= len(photos) {
+		return nil
+	}
+	photos[from], photos[to] = photos[to], photos[from]
+
+	// * Positions are rewritten as 0..n-1 so gaps left by deleted photos disappear
+	for position, photo := range photos {
+		if photo.Position == position {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `update room_photos set position = $1, updated_at = $2 where id = $3`, position, time.Now(), photo.ID)
+		if err != nil {
+			m.logError(ctx, "MoveRoomPhoto", err)
+			return err
+		}
+
+		after := photo
+		after.Position = position
+		err = m.insertAudit(ctx, tx, actor, auditActionUpdate, auditEntityRoomPhoto, photo.ID, photo, after)
+		if err != nil {
+			m.logError(ctx, "MoveRoomPhoto", err)
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "MoveRoomPhoto", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRoomPhoto: deletes a photo of the room and returns it, so the caller can remove its files
+func (m *postgressDBRepo) DeleteRoomPhoto(ctx context.Context, roomId, photoId int, actor models.Actor) (models.RoomPhoto, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "DeleteRoomPhoto")
+
+	var photo models.RoomPhoto
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteRoomPhoto", err)
+		return photo, err
+	}
+	defer tx.Rollback()
+
+	query := `delete from room_photos where id = $1 and room_id = $2
+	returning id, room_id, url, thumb_url, medium_url, position, created_at, updated_at`
+
+	err = tx.QueryRowContext(ctx, query, photoId, roomId).Scan(&photo.ID, &photo.RoomID, &photo.URL, &photo.ThumbURL, &photo.MediumURL, &photo.Position, &photo.CreatedAt, &photo.UpdatedAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "DeleteRoomPhoto", err)
+		}
+		return photo, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionDelete, auditEntityRoomPhoto, photo.ID, photo, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteRoomPhoto", err)
+		return photo, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "DeleteRoomPhoto", err)
+		return photo, err
+	}
+
+	return photo, nil
+}
@@ -0,0 +1,138 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/imrcht/bed-n-breakfast/internals/metrics"
+	"github.com/imrcht/bed-n-breakfast/internals/models"
+)
+
+const (
+	auditEntityStayRule = "stay_rule"
+
+	stayRuleColumns = `id, room_id, start_date, end_date, min_nights, max_nights, closed_to_arrival, closed_to_departure, created_at, updated_at`
+)
+
+func scanStayRule(row scanner) (models.StayRule, error) {
+	var rule models.StayRule
+
+	err := row.Scan(&rule.ID, &rule.RoomID, &rule.StartDate, &rule.EndDate, &rule.MinNights, &rule.MaxNights,
+		&rule.ClosedToArrival, &rule.ClosedToDeparture, &rule.CreatedAt, &rule.UpdatedAt)
+
+	return rule, err
+}
+
+// StayRules: returns the stay rules ending on or after from, of one room or of every room when roomId is 0
+func (m *postgressDBRepo) StayRules(ctx context.Context, roomId int, from time.Time) ([]models.StayRule, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "StayRules")
+
+	query := `select ` + stayRuleColumns + ` from stay_rules where end_date >= $1`
+	args := []interface{}{from}
+	if roomId > 0 {
+		query += ` and room_id = $2`
+		args = append(args, roomId)
+	}
+	query += ` order by room_id, start_date, id`
+
+	var rules []models.StayRule
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		m.logError(ctx, "StayRules", err)
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rule, err := scanStayRule(rows)
+		if err != nil {
+			m.logError(ctx, "StayRules", err)
+			return rules, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		m.logError(ctx, "StayRules", err)
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// InsertStayRule: adds a stay rule to a room and records it in the audit log
+func (m *postgressDBRepo) InsertStayRule(ctx context.Context, rule models.StayRule, actor models.Actor) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "InsertStayRule")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "InsertStayRule", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into stay_rules (room_id, start_date, end_date, min_nights, max_nights, closed_to_arrival, closed_to_departure, created_at, updated_at)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = tx.QueryRowContext(ctx, query, rule.RoomID, rule.StartDate, rule.EndDate, rule.MinNights, rule.MaxNights,
+		rule.ClosedToArrival, rule.ClosedToDeparture, time.Now(), time.Now()).Scan(&rule.ID)
+	if err != nil {
+		m.logError(ctx, "InsertStayRule", err)
+		return 0, err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionInsert, auditEntityStayRule, rule.ID, nil, rule)
+	if err != nil {
+		m.logError(ctx, "InsertStayRule", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "InsertStayRule", err)
+		return 0, err
+	}
+
+	return rule.ID, nil
+}
+
+// DeleteStayRule: deletes a stay rule of the room, sql.ErrNoRows when the room has no such rule
+func (m *postgressDBRepo) DeleteStayRule(ctx context.Context, roomId, ruleId int, actor models.Actor) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+	defer metrics.DBQueryDuration.ObserveSince(time.Now(), "DeleteStayRule")
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteStayRule", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	rule, err := scanStayRule(tx.QueryRowContext(ctx, `delete from stay_rules where id = $1 and room_id = $2 returning `+stayRuleColumns, ruleId, roomId))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.logError(ctx, "DeleteStayRule", err)
+		}
+		return err
+	}
+
+	err = m.insertAudit(ctx, tx, actor, auditActionDelete, auditEntityStayRule, rule.ID, rule, nil)
+	if err != nil {
+		m.logError(ctx, "DeleteStayRule", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		m.logError(ctx, "DeleteStayRule", err)
+		return err
+	}
+
+	return nil
+}
@@ -1,22 +1,68 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/imrcht/bed-n-breakfast/internals/models"
 )
 
+// * Errors returned by the repository which handlers show to the user
+var (
+	ErrDuplicateSlug        = errors.New("another room already uses this slug")
+	ErrRoomHasReservations  = errors.New("room has reservations, deactivate it instead")
+	ErrRoomUnavailable      = errors.New("room is booked or held by another guest for these dates")
+	ErrReservationCancelled = errors.New("reservation is already cancelled")
+	ErrPolicyInUse          = errors.New("cancellation policy is used by rate plans, remove them first")
+)
+
 type DatabaseRepo interface {
-	AllUsers() bool
+	AllUsers(ctx context.Context) bool
+	Ping(ctx context.Context) error
+
+	BookReservation(ctx context.Context, res models.Reservation, payment models.Payment, holder string, actor models.Actor) (models.Reservation, error)
+	GetReservationById(ctx context.Context, id int) (models.Reservation, error)
+	GetReservationByCode(ctx context.Context, code, email string) (models.Reservation, error)
+	ReservationIdByCode(ctx context.Context, code string) (int, error)
+	UpdateReservation(ctx context.Context, res models.Reservation, actor models.Actor) error
+	ChangeReservation(ctx context.Context, res models.Reservation, payment models.Payment, holder string, actor models.Actor) error
+	CancelReservation(ctx context.Context, id, fee int, actor models.Actor) error
+	InsertRoomRestriction(ctx context.Context, res models.RoomRestriction, actor models.Actor) error
+	RoomRestrictionsBetween(ctx context.Context, roomId int, from, to time.Time) ([]models.RoomRestriction, error)
+	SearchAvailabilityByDatesByRoomId(ctx context.Context, start_date, end_date time.Time, roomId int, holder string) (bool, error)
+	SearchAvailabilityForAllRoomsByDates(ctx context.Context, start_date, end_date time.Time, guests int, holder string) ([]models.Room, error)
+	SearchFlexibleAvailability(ctx context.Context, from, to time.Time, nights, guests int, holder string) ([]models.StayOption, error)
+	HoldRoom(ctx context.Context, hold models.RoomHold) (int, error)
+	DeleteExpiredHolds(ctx context.Context) (int64, error)
+	RoomHoldsBetween(ctx context.Context, roomId int, from, to time.Time, holder string) ([]models.RoomHold, error)
+	GetRoomById(ctx context.Context, id int) (models.Room, error)
+	GetRoomBySlug(ctx context.Context, slug string) (models.Room, error)
+	AllRooms(ctx context.Context, activeOnly bool) ([]models.Room, error)
+	InsertRoom(ctx context.Context, room models.Room, actor models.Actor) (int, error)
+	UpdateRoom(ctx context.Context, room models.Room, actor models.Actor) error
+	DeleteRoom(ctx context.Context, id int, actor models.Actor) error
+	InsertRoomPhoto(ctx context.Context, photo models.RoomPhoto, actor models.Actor) (int, error)
+	MoveRoomPhoto(ctx context.Context, roomId, photoId, offset int, actor models.Actor) error
+	DeleteRoomPhoto(ctx context.Context, roomId, photoId int, actor models.Actor) (models.RoomPhoto, error)
+	StayRules(ctx context.Context, roomId int, from time.Time) ([]models.StayRule, error)
+	InsertStayRule(ctx context.Context, rule models.StayRule, actor models.Actor) (int, error)
+	DeleteStayRule(ctx context.Context, roomId, ruleId int, actor models.Actor) error
+	CancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error)
+	InsertCancellationPolicy(ctx context.Context, policy models.CancellationPolicy, actor models.Actor) (int, error)
+	DeleteCancellationPolicy(ctx context.Context, id int, actor models.Actor) error
+	RatePlans(ctx context.Context, roomId int) ([]models.RatePlan, error)
+	InsertRatePlan(ctx context.Context, plan models.RatePlan, actor models.Actor) (int, error)
+	DeleteRatePlan(ctx context.Context, roomId, planId int, actor models.Actor) error
+	PaymentsByReservation(ctx context.Context, reservationId int) ([]models.Payment, error)
+	PaymentByReference(ctx context.Context, provider, reference string) (models.Payment, error)
+	UpdatePayment(ctx context.Context, payment models.Payment, actor models.Actor) error
+	ApplyPaymentEvent(ctx context.Context, paymentId int, event models.PaymentEvent, actor models.Actor) (bool, error)
 
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(res models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomId(start_date, end_date time.Time, roomId int) (bool, error)
-	SearchAvailabilityForAllRoomsByDates(start_date, end_date time.Time) ([]models.Room, error)
-	GetRoomById(id int) (models.Room, error)
+	GetUserById(ctx context.Context, id int) (models.User, error)
+	UpdateUser(ctx context.Context, user models.User, actor models.Actor) error
+	Authenticate(ctx context.Context, email, testPassword string, actor models.Actor) (models.User, string, error)
+	InsertUser(ctx context.Context, user models.User, actor models.Actor) (models.User, error)
 
-	GetUserById(id int) (models.User, error)
-	UpdateUser(user models.User) error
-	Authenticate(email, testPassword string) (models.User, string, error)
-	InsertUser(user models.User) (models.User, error)
+	AllAuditEntries(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
 }
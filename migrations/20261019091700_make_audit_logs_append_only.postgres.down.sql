@@ -0,0 +1,2 @@
+drop trigger if exists audit_logs_append_only on audit_logs;
+drop function if exists audit_logs_append_only();
@@ -0,0 +1,10 @@
+-- * Audit entries can't be changed or removed, an update or delete fails loudly instead of silently doing nothing
+create or replace function audit_logs_append_only() returns trigger as $$
+begin
+    raise exception 'audit_logs is append-only, % is not allowed', tg_op;
+end;
+$$ language plpgsql;
+
+drop trigger if exists audit_logs_append_only on audit_logs;
+create trigger audit_logs_append_only before update or delete on audit_logs
+    for each row execute function audit_logs_append_only();
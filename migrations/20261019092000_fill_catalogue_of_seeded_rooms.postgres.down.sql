@@ -0,0 +1 @@
+update rooms set slug = '', description = '';
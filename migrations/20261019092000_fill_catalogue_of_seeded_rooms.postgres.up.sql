@@ -0,0 +1,3 @@
+update rooms set slug = 'generals-quarters', description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.' where room_name = 'Generals';
+update rooms set slug = 'majors-suite', description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.' where room_name = 'Majors';
+update rooms set slug = 'room-' || id where slug = '';
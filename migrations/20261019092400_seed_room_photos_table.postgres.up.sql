@@ -0,0 +1,4 @@
+insert into room_photos (room_id, url, position, created_at, updated_at)
+select id, '/static/images/generals-quarters.png', 0, now(), now() from rooms where slug = 'generals-quarters';
+insert into room_photos (room_id, url, position, created_at, updated_at)
+select id, '/static/images/marjors-suite.png', 0, now(), now() from rooms where slug = 'majors-suite';
@@ -0,0 +1 @@
+update rooms set nightly_rate = 0, capacity = 2, included_guests = 2, extra_adult_fee = 0, extra_child_fee = 0 where slug in ('generals-quarters', 'majors-suite');
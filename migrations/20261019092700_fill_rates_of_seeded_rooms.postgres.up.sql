@@ -0,0 +1,2 @@
+update rooms set nightly_rate = 9500, capacity = 3, included_guests = 2, extra_adult_fee = 2500, extra_child_fee = 1500 where slug = 'generals-quarters';
+update rooms set nightly_rate = 14500, capacity = 4, included_guests = 2, extra_adult_fee = 3000, extra_child_fee = 2000 where slug = 'majors-suite';
@@ -0,0 +1,21 @@
+update reservations set confirmation_code = null;
+
+-- * Each code is drawn again while another reservation has it, so the unique index created next never fails on a collision
+do $$
+declare
+    reservation record;
+    code text;
+begin
+    for reservation in select id from reservations order by id loop
+        loop
+            select 'BNB-' || string_agg(substr('23456789ABCDEFGHJKMNPQRSTVWXYZ', 1 + floor(random() * 30)::int, 1), '')
+            into code
+            from generate_series(1, 6);
+
+            exit when not exists (select 1 from reservations where confirmation_code = code);
+        end loop;
+
+        update reservations set confirmation_code = code where id = reservation.id;
+    end loop;
+end;
+$$;
@@ -0,0 +1,2 @@
+delete from rate_plans;
+delete from cancellation_policies;
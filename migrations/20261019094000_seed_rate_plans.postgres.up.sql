@@ -0,0 +1,9 @@
+insert into cancellation_policies (name, free_cancellation_days, late_penalty_percent, created_at, updated_at) values
+    ('Free until 7 days before, 50% after', 7, 50, now(), now()),
+    ('Non-refundable', 0, 100, now(), now());
+
+insert into rate_plans (room_id, name, discount_percent, cancellation_policy_id, created_at, updated_at)
+select rooms.id, plan.name, plan.discount, cancellation_policies.id, now(), now()
+from rooms
+cross join (values ('Flexible', 0, 'Free until 7 days before, 50% after'), ('Non-refundable', 10, 'Non-refundable')) as plan(name, discount, policy)
+join cancellation_policies on cancellation_policies.name = plan.policy;
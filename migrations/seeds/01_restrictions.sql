@@ -0,0 +1,8 @@
+-- * Restriction ids are referenced by the code, 1 blocks rooms for cleaning, 2 for the owners and 3 marks a reservation
+INSERT INTO public.restrictions (id,restriction_name,created_at,updated_at) VALUES
+	 (1,'Cleaning restriction',now(),now()),
+	 (2,'Owners restriction',now(),now()),
+	 (3,'Reservation',now(),now())
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('public.restrictions', 'id'), (SELECT max(id) FROM public.restrictions));
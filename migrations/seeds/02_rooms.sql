@@ -0,0 +1,4 @@
+INSERT INTO public.rooms (room_name,slug,description,capacity,nightly_rate,included_guests,extra_adult_fee,extra_child_fee,created_at,updated_at)
+SELECT name, slug, 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.', capacity, rate, 2, adult_fee, child_fee, now(), now()
+FROM (VALUES ('Generals', 'generals-quarters', 3, 9500, 2500, 1500), ('Majors', 'majors-suite', 4, 14500, 3000, 2000)) AS seed(name, slug, capacity, rate, adult_fee, child_fee)
+WHERE NOT EXISTS (SELECT 1 FROM public.rooms WHERE slug = seed.slug OR room_name = seed.name);
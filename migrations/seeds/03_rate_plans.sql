@@ -0,0 +1,12 @@
+-- * Rooms without rate plans are booked at their nightly rate and can be cancelled for free, each seeded room gets a flexible and a non-refundable plan
+INSERT INTO public.cancellation_policies (name,free_cancellation_days,late_penalty_percent,created_at,updated_at)
+SELECT name, free_days, penalty, now(), now()
+FROM (VALUES ('Free until 7 days before, 50% after', 7, 50), ('Non-refundable', 0, 100)) AS seed(name, free_days, penalty)
+WHERE NOT EXISTS (SELECT 1 FROM public.cancellation_policies WHERE name = seed.name);
+
+INSERT INTO public.rate_plans (room_id,name,discount_percent,cancellation_policy_id,created_at,updated_at)
+SELECT rooms.id, plan.name, plan.discount, cancellation_policies.id, now(), now()
+FROM public.rooms
+CROSS JOIN (VALUES ('Flexible', 0, 'Free until 7 days before, 50% after'), ('Non-refundable', 10, 'Non-refundable')) AS plan(name, discount, policy)
+JOIN public.cancellation_policies ON cancellation_policies.name = plan.policy
+WHERE NOT EXISTS (SELECT 1 FROM public.rate_plans WHERE rate_plans.room_id = rooms.id);
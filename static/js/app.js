@@ -110,6 +110,14 @@ function ChooseAvailability(room_id, csrf_token) {
                         </div>
 
                     </div>
+                    <div class="form-row mt-2">
+                        <div class="col">
+                            <input required class="form-control" type="number" min="1" name="adults" id="adults" value="2" placeholder="Adults">
+                        </div>
+                        <div class="col">
+                            <input required class="form-control" type="number" min="0" name="children" id="children" value="0" placeholder="Children">
+                        </div>
+                    </div>
                 </div>
             </div>
         </form>
@@ -124,6 +132,7 @@ function ChooseAvailability(room_id, csrf_token) {
             showOnFocus: true,
             minDate: new Date(),
           });
+          disableUnavailableDates(rp, room_id);
         },
         didOpen: () => {
           document.getElementById('start').removeAttribute('disabled');
@@ -148,18 +157,37 @@ function ChooseAvailability(room_id, csrf_token) {
                   showConfirmButton: false,
                   msg:
                     '<p>Room is available!</p>' +
+                    '<p>Total: ' +
+                    data.price +
+                    '</p>' +
                     '<p><a href="/book-room?id=' +
                     data.room_id +
                     '&s=' +
                     data.start_date +
                     '&e=' +
                     data.end_date +
+                    '&a=' +
+                    data.adults +
+                    '&c=' +
+                    data.children +
                     '" class="btn btn-primary">' +
                     'Book Now!</a></p>',
                 });
+              } else if (data.suggestions) {
+                attention.custom({
+                  icon: 'error',
+                  showConfirmButton: false,
+                  msg:
+                    '<p>' +
+                    escapeHTML(data.message.trim() || 'Room is not available!!') +
+                    '</p>' +
+                    stayOptions('Earlier dates', data.suggestions.earlier) +
+                    stayOptions('Later dates', data.suggestions.later) +
+                    stayOptions('Split your stay, each part is booked on its own', data.suggestions.split_stay),
+                });
               } else {
                 attention.error({
-                  msg: '<p>Room is not available!!</p>',
+                  msg: data.message.trim() || 'Room is not available!!',
                 });
               }
             });
@@ -167,3 +195,58 @@ function ChooseAvailability(room_id, csrf_token) {
       });
     });
 }
+
+// * Loads a year of the room's availability calendar and disables the days a stay can't arrive or leave on, the pickers stay usable if it fails
+function disableUnavailableDates(rangepicker, room_id) {
+  fetch('/availability-calendar?room_id=' + encodeURIComponent(room_id) + '&months=12')
+    .then((response) => response.json())
+    .then((data) => {
+      let status = {};
+      data.days.forEach((day) => {
+        status[day.date] = day.status;
+      });
+
+      let allow = (statuses) => (date) => {
+        let s = status[Datepicker.formatDate(date, 'yyyy-mm-dd')];
+        if (s === undefined) {
+          return true;
+        }
+        return { enabled: statuses.includes(s), classes: 'day-' + s.replace(/_/g, '-') };
+      };
+
+      rangepicker.datepickers[0].setOptions({ beforeShowDay: allow(['available', 'check_in_only']) });
+      rangepicker.datepickers[1].setOptions({ beforeShowDay: allow(['available', 'check_out_only']) });
+    })
+    .catch((err) => console.log(err));
+}
+
+// * Lists suggested stays with a link to book each of them, nothing when there are none
+function stayOptions(title, stays) {
+  if (!stays || stays.length === 0) {
+    return '';
+  }
+
+  let html = '<p class="mt-3 mb-1"><strong>' + escapeHTML(title) + '</strong></p><ul class="list-unstyled">';
+  stays.forEach((stay) => {
+    html +=
+      '<li class="mb-1">' +
+      escapeHTML(stay.room_name) +
+      ', ' +
+      stay.start_date +
+      ' to ' +
+      stay.end_date +
+      ', ' +
+      stay.price +
+      ' <a href="' +
+      escapeHTML(stay.book_url) +
+      '" class="btn btn-sm btn-primary">Book</a></li>';
+  });
+
+  return html + '</ul>';
+}
+
+function escapeHTML(s) {
+  const div = document.createElement('div');
+  div.textContent = s;
+  return div.innerHTML;
+}